@@ -0,0 +1,305 @@
+package core
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// 元素不超过此数时容器保存为有序数组，否则保存为位图
+const arrayContainerMaxSize = 4096
+
+// DocId 的压缩位图，和 Roaring Bitmap 一样按高 16 位把元素分到不同的容器中
+// 稀疏的容器保存为低 16 位的有序数组，稠密的容器保存为 65536 位的位图
+// nil 表示空位图，只读方法都可以在 nil 上调用
+type Bitmap struct {
+	// 各容器的高 16 位，从小到大排列
+	keys       []uint16
+	containers []*container
+}
+
+type container struct {
+	// 有序数组容器，bits 为 nil 时使用
+	array []uint16
+
+	// 位图容器，不为 nil 时有 1024 个 uint64
+	bits []uint64
+
+	cardinality int
+}
+
+func NewBitmap() *Bitmap {
+	return &Bitmap{}
+}
+
+// 用 DocId 列表生成位图
+func BitmapOf(docIds ...uint32) *Bitmap {
+	bitmap := NewBitmap()
+	for _, docId := range docIds {
+		bitmap.Add(docId)
+	}
+	return bitmap
+}
+
+// 容器在 keys 中的位置，不存在时返回应插入的位置和 false
+func (bitmap *Bitmap) search(key uint16) (int, bool) {
+	i := sort.Search(len(bitmap.keys), func(i int) bool { return bitmap.keys[i] >= key })
+	return i, i < len(bitmap.keys) && bitmap.keys[i] == key
+}
+
+// 得到高 16 位为 key 的容器，不存在时插入一个空容器
+func (bitmap *Bitmap) containerFor(key uint16) (int, *container) {
+	i, found := bitmap.search(key)
+	if !found {
+		bitmap.keys = append(bitmap.keys, 0)
+		copy(bitmap.keys[i+1:], bitmap.keys[i:])
+		bitmap.keys[i] = key
+		bitmap.containers = append(bitmap.containers, nil)
+		copy(bitmap.containers[i+1:], bitmap.containers[i:])
+		bitmap.containers[i] = &container{}
+	}
+	return i, bitmap.containers[i]
+}
+
+// 加入一个元素，只能用于尚未共享的位图，共享的位图应使用 With
+func (bitmap *Bitmap) Add(docId uint32) {
+	_, c := bitmap.containerFor(uint16(docId >> 16))
+	c.add(uint16(docId))
+}
+
+// 删除一个元素，只能用于尚未共享的位图
+func (bitmap *Bitmap) Remove(docId uint32) {
+	i, found := bitmap.search(uint16(docId >> 16))
+	if !found {
+		return
+	}
+	c := bitmap.containers[i]
+	c.remove(uint16(docId))
+	if c.cardinality == 0 {
+		bitmap.keys = append(bitmap.keys[:i], bitmap.keys[i+1:]...)
+		bitmap.containers = append(bitmap.containers[:i], bitmap.containers[i+1:]...)
+	}
+}
+
+// 返回加入 docIds 后的新位图，原位图不变
+// 新位图和原位图共享未改变的容器，只复制被修改的容器
+func (bitmap *Bitmap) With(docIds ...uint32) *Bitmap {
+	result := &Bitmap{}
+	if bitmap != nil {
+		result.keys = append(result.keys, bitmap.keys...)
+		result.containers = append(result.containers, bitmap.containers...)
+	}
+	copied := make(map[uint16]bool)
+	for _, docId := range docIds {
+		key := uint16(docId >> 16)
+		i, c := result.containerFor(key)
+		if !copied[key] {
+			c = c.clone()
+			result.containers[i] = c
+			copied[key] = true
+		}
+		c.add(uint16(docId))
+	}
+	return result
+}
+
+func (bitmap *Bitmap) Contains(docId uint32) bool {
+	if bitmap == nil {
+		return false
+	}
+	i, found := bitmap.search(uint16(docId >> 16))
+	return found && bitmap.containers[i].contains(uint16(docId))
+}
+
+// 元素个数
+func (bitmap *Bitmap) Cardinality() (cardinality int) {
+	if bitmap == nil {
+		return 0
+	}
+	for _, c := range bitmap.containers {
+		cardinality += c.cardinality
+	}
+	return
+}
+
+// 从小到大对每个元素调用 fn
+func (bitmap *Bitmap) ForEach(fn func(docId uint32)) {
+	if bitmap == nil {
+		return
+	}
+	for i, c := range bitmap.containers {
+		high := uint32(bitmap.keys[i]) << 16
+		if c.bits == nil {
+			for _, low := range c.array {
+				fn(high | uint32(low))
+			}
+			continue
+		}
+		for j, word := range c.bits {
+			for word != 0 {
+				fn(high | uint32(j*64+bits.TrailingZeros64(word)))
+				word &= word - 1
+			}
+		}
+	}
+}
+
+// 位图占用内存的估计值
+func (bitmap *Bitmap) sizeInBytes() (size int64) {
+	if bitmap == nil {
+		return 0
+	}
+	size = int64(len(bitmap.keys)) * 2
+	for _, c := range bitmap.containers {
+		size += 64 + int64(len(c.array))*2 + int64(len(c.bits))*8
+	}
+	return
+}
+
+// 从小到大排列的全部元素
+func (bitmap *Bitmap) ToArray() []uint32 {
+	docIds := make([]uint32, 0, bitmap.Cardinality())
+	bitmap.ForEach(func(docId uint32) {
+		docIds = append(docIds, docId)
+	})
+	return docIds
+}
+
+// 两个位图的交集
+func And(a, b *Bitmap) *Bitmap {
+	result := NewBitmap()
+	if a == nil || b == nil {
+		return result
+	}
+	for i, j := 0, 0; i < len(a.keys) && j < len(b.keys); {
+		switch {
+		case a.keys[i] < b.keys[j]:
+			i++
+		case a.keys[i] > b.keys[j]:
+			j++
+		default:
+			if c := a.containers[i].and(b.containers[j]); c.cardinality > 0 {
+				result.keys = append(result.keys, a.keys[i])
+				result.containers = append(result.containers, c)
+			}
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+func (c *container) clone() *container {
+	return &container{
+		array:       append([]uint16(nil), c.array...),
+		bits:        append([]uint64(nil), c.bits...),
+		cardinality: c.cardinality,
+	}
+}
+
+func (c *container) contains(low uint16) bool {
+	if c.bits != nil {
+		return c.bits[low>>6]&(1<<(low&63)) != 0
+	}
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= low })
+	return i < len(c.array) && c.array[i] == low
+}
+
+func (c *container) add(low uint16) {
+	if c.bits != nil {
+		if !c.contains(low) {
+			c.bits[low>>6] |= 1 << (low & 63)
+			c.cardinality++
+		}
+		return
+	}
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= low })
+	if i < len(c.array) && c.array[i] == low {
+		return
+	}
+	c.array = append(c.array, 0)
+	copy(c.array[i+1:], c.array[i:])
+	c.array[i] = low
+	c.cardinality++
+
+	// 数组过大时转换为位图，位图总是占用 8KB
+	if len(c.array) > arrayContainerMaxSize {
+		c.bits = make([]uint64, 1024)
+		for _, v := range c.array {
+			c.bits[v>>6] |= 1 << (v & 63)
+		}
+		c.array = nil
+	}
+}
+
+func (c *container) remove(low uint16) {
+	if !c.contains(low) {
+		return
+	}
+	c.cardinality--
+	if c.bits == nil {
+		i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= low })
+		c.array = append(c.array[:i], c.array[i+1:]...)
+		return
+	}
+	c.bits[low>>6] &^= 1 << (low & 63)
+
+	// 元素减少到数组容器的上限时转换回数组
+	if c.cardinality == arrayContainerMaxSize {
+		c.array = make([]uint16, 0, c.cardinality)
+		for i, word := range c.bits {
+			for word != 0 {
+				c.array = append(c.array, uint16(i*64+bits.TrailingZeros64(word)))
+				word &= word - 1
+			}
+		}
+		c.bits = nil
+	}
+}
+
+func (c *container) and(other *container) *container {
+	result := &container{}
+	switch {
+	case c.bits != nil && other.bits != nil:
+		words := make([]uint64, 1024)
+		for i := range words {
+			words[i] = c.bits[i] & other.bits[i]
+			result.cardinality += bits.OnesCount64(words[i])
+		}
+		if result.cardinality > arrayContainerMaxSize {
+			result.bits = words
+			return result
+		}
+		for i, word := range words {
+			for word != 0 {
+				result.array = append(result.array, uint16(i*64+bits.TrailingZeros64(word)))
+				word &= word - 1
+			}
+		}
+	case c.bits != nil || other.bits != nil:
+		array, set := c, other
+		if c.bits != nil {
+			array, set = other, c
+		}
+		for _, low := range array.array {
+			if set.contains(low) {
+				result.array = append(result.array, low)
+			}
+		}
+		result.cardinality = len(result.array)
+	default:
+		for i, j := 0, 0; i < len(c.array) && j < len(other.array); {
+			switch {
+			case c.array[i] < other.array[j]:
+				i++
+			case c.array[i] > other.array[j]:
+				j++
+			default:
+				result.array = append(result.array, c.array[i])
+				i++
+				j++
+			}
+		}
+		result.cardinality = len(result.array)
+	}
+	return result
+}
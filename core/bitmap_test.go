@@ -0,0 +1,46 @@
+package core
+
+import (
+	"github.com/huichen/wukong/utils"
+	"testing"
+)
+
+func TestBitmap(t *testing.T) {
+	// 第一个容器超过 arrayContainerMaxSize 个元素，转换为位图容器
+	a := NewBitmap()
+	for docId := uint32(0); docId < 10000; docId += 2 {
+		a.Add(docId)
+	}
+	a.Add(1<<16 + 7)
+	utils.Expect(t, "true", a.containers[0].bits != nil)
+	utils.Expect(t, "5001", a.Cardinality())
+
+	b := BitmapOf(3, 4, 9998, 10000, 1<<16+7, 1<<20)
+	utils.Expect(t, "[4 9998 65543]", And(a, b).ToArray())
+	utils.Expect(t, "[]", And(a, nil).ToArray())
+
+	// With 不改变原位图
+	c := b.With(5, 1<<20+1)
+	utils.Expect(t, "6", b.Cardinality())
+	utils.Expect(t, "false", b.Contains(5))
+	utils.Expect(t, "[3 4 5 9998 10000 65543 1048576 1048577]", c.ToArray())
+}
+
+func TestBitmapRemove(t *testing.T) {
+	a := NewBitmap()
+	for docId := uint32(0); docId <= 2*arrayContainerMaxSize; docId += 2 {
+		a.Add(docId)
+	}
+	a.Add(1<<16 + 7)
+	utils.Expect(t, "true", a.containers[0].bits != nil)
+
+	// 位图容器的元素减少到上限时转换回数组，容器为空时被删除
+	a.Remove(0)
+	a.Remove(1)
+	utils.Expect(t, "true", a.containers[0].bits == nil)
+	utils.Expect(t, "[4096 false true]", []interface{}{a.containers[0].cardinality, a.Contains(0), a.Contains(2)})
+	a.Remove(1<<16 + 7)
+	utils.Expect(t, "1", len(a.containers))
+	a.Remove(1 << 20)
+	utils.Expect(t, "4096", a.Cardinality())
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"sync"
+)
+
+// 按列保存的文档数值字段，用于按 CreateTime 等字段过滤和排序
+// 每个文档分配一个序号，每列是以序号为下标的数组，读取时只需一次 map 查找
+// 写入时还需持有 tableLock，和文档长度等统计保持一致
+type docValues struct {
+	sync.RWMutex
+
+	// DocId 到序号的映射
+	ordinals map[uint32]uint32
+
+	// 序号对应的 DocId，被删除文档的序号为 0 并放入 free 中等待复用
+	docIds []uint32
+	free   []uint32
+
+	// 列名按出现的顺序排列，文档没有该字段时值为 0
+	names   []string
+	columns map[string][]int64
+
+	// 每列中有该字段的文档的序号
+	present map[string]*Bitmap
+}
+
+func (values *docValues) init() {
+	values.ordinals = make(map[uint32]uint32)
+	values.docIds = nil
+	values.free = nil
+	values.names = nil
+	values.columns = make(map[string][]int64)
+	values.present = make(map[string]*Bitmap)
+}
+
+// 设置文档的全部字段，文档已存在时覆盖原有的值，fields 中没有的字段置为 0 并标记为不存在
+func (values *docValues) set(docId uint32, fields map[string]int64) {
+	ordinal, found := values.ordinals[docId]
+	if !found {
+		if n := len(values.free); n > 0 {
+			ordinal = values.free[n-1]
+			values.free = values.free[:n-1]
+			values.docIds[ordinal] = docId
+		} else {
+			ordinal = uint32(len(values.docIds))
+			values.docIds = append(values.docIds, docId)
+			for _, name := range values.names {
+				values.columns[name] = append(values.columns[name], 0)
+			}
+		}
+		values.ordinals[docId] = ordinal
+	}
+	for name := range fields {
+		if _, found := values.columns[name]; !found {
+			values.names = append(values.names, name)
+			values.columns[name] = make([]int64, len(values.docIds))
+			values.present[name] = NewBitmap()
+		}
+	}
+	for _, name := range values.names {
+		value, found := fields[name]
+		values.columns[name][ordinal] = value
+		if found {
+			values.present[name].Add(ordinal)
+		} else {
+			values.present[name].Remove(ordinal)
+		}
+	}
+}
+
+func (values *docValues) remove(docId uint32) {
+	if ordinal, found := values.ordinals[docId]; found {
+		delete(values.ordinals, docId)
+		values.docIds[ordinal] = 0
+		values.free = append(values.free, ordinal)
+		for _, name := range values.names {
+			values.present[name].Remove(ordinal)
+		}
+	}
+}
+
+// 得到文档的数值字段，文档不在索引中或没有该字段时返回 false，此函数线程安全
+func (indexer *Indexer) DocValue(docId uint32, field string) (int64, bool) {
+	indexer.docValues.RLock()
+	defer indexer.docValues.RUnlock()
+	ordinal, found := indexer.docValues.ordinals[docId]
+	if !found || !indexer.docValues.present[field].Contains(ordinal) {
+		return 0, false
+	}
+	return indexer.docValues.columns[field][ordinal], true
+}
+
+// 得到 docIds 中在本索引器中且有该字段的文档的字段值，此函数线程安全
+func (indexer *Indexer) FieldValues(field string, docIds []uint32) map[uint32]int64 {
+	indexer.docValues.RLock()
+	defer indexer.docValues.RUnlock()
+	result := make(map[uint32]int64)
+	column, present := indexer.docValues.columns[field], indexer.docValues.present[field]
+	for _, docId := range docIds {
+		if ordinal, found := indexer.docValues.ordinals[docId]; found && present.Contains(ordinal) {
+			result[docId] = column[ordinal]
+		}
+	}
+	return result
+}
+
+// 得到有该字段且值在 [min, max] 之中的文档，没有该列时返回空位图，此函数线程安全
+// 列没有排序或索引，每次调用都扫描有该字段的全部文档
+func (indexer *Indexer) FieldRangeBitmap(field string, min, max int64) *Bitmap {
+	indexer.docValues.RLock()
+	defer indexer.docValues.RUnlock()
+	bitmap := NewBitmap()
+	column := indexer.docValues.columns[field]
+	indexer.docValues.present[field].ForEach(func(ordinal uint32) {
+		if value := column[ordinal]; value >= min && value <= max {
+			bitmap.Add(indexer.docValues.docIds[ordinal])
+		}
+	})
+	return bitmap
+}
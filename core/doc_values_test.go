@@ -0,0 +1,60 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/huichen/wukong/utils"
+	"octopus/types"
+	"testing"
+)
+
+func TestDocValues(t *testing.T) {
+	var indexer Indexer
+	indexer.Init(IndexerInitOptions{})
+	for docId := uint32(1); docId <= 3; docId++ {
+		indexer.AddDocumentToCache(&types.DocumentIndex{
+			DocId:    docId,
+			Keywords: []types.Keyword{{Word: "恋爱", Weight: 1}},
+			Fields:   map[string]int64{"CreateTime": int64(docId) * 100},
+		}, docId == 3)
+	}
+	// 替换文档 2 时加入新的列，删除文档 1 后新文档复用它的序号
+	indexer.AddDocumentToCache(&types.DocumentIndex{
+		DocId:    2,
+		Keywords: []types.Keyword{{Word: "恋爱", Weight: 1}},
+		Fields:   map[string]int64{"Likes": 7},
+	}, true)
+	indexer.RemoveDocument(1)
+	indexer.AddDocumentToCache(&types.DocumentIndex{
+		DocId:    4,
+		Keywords: []types.Keyword{{Word: "恋爱", Weight: 1}},
+		Fields:   map[string]int64{"CreateTime": 400},
+	}, true)
+	utils.Expect(t, "0", indexer.docValues.ordinals[4])
+	utils.Expect(t, "0 false", fmtValue(indexer.DocValue(2, "CreateTime")))
+	utils.Expect(t, "7 true", fmtValue(indexer.DocValue(2, "Likes")))
+	utils.Expect(t, "0 false", fmtValue(indexer.DocValue(1, "CreateTime")))
+	utils.Expect(t, "0 false", fmtValue(indexer.DocValue(3, "Shares")))
+	utils.Expect(t, "[3 4]", indexer.FieldRangeBitmap("CreateTime", 300, 500).ToArray())
+	// 没有该字段的文档不在任何范围中
+	utils.Expect(t, "[]", indexer.FieldRangeBitmap("CreateTime", 0, 0).ToArray())
+	utils.Expect(t, "[2]", indexer.FieldRangeBitmap("Likes", 0, 10).ToArray())
+	utils.Expect(t, "[]", indexer.FieldRangeBitmap("Shares", 0, 0).ToArray())
+	utils.Expect(t, "map[3:300 4:400]", indexer.FieldValues("CreateTime", []uint32{1, 3, 4, 5}))
+
+	var buffer bytes.Buffer
+	utils.Expect(t, "<nil>", indexer.Save(&buffer))
+	var loaded Indexer
+	loaded.Init(IndexerInitOptions{})
+	utils.Expect(t, "<nil>", loaded.Load(&buffer))
+	utils.Expect(t, "400 true", fmtValue(loaded.DocValue(4, "CreateTime")))
+	utils.Expect(t, "7 true", fmtValue(loaded.DocValue(2, "Likes")))
+	utils.Expect(t, "[3]", loaded.FieldRangeBitmap("CreateTime", 300, 300).ToArray())
+	utils.Expect(t, "0 false", fmtValue(loaded.DocValue(2, "CreateTime")))
+	utils.Expect(t, "0 false", fmtValue(loaded.DocValue(3, "Likes")))
+	utils.Expect(t, "[]", loaded.FieldRangeBitmap("Likes", 0, 0).ToArray())
+}
+
+func fmtValue(value int64, found bool) string {
+	return fmt.Sprint(value, found)
+}
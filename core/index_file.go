@@ -0,0 +1,284 @@
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sync/atomic"
+)
+
+// 索引文件格式，数值均为小端序：
+//
+//	文件头     indexFileMagic, 版本号 uint32
+//	文档长度   文档数 uint32, 每个文档 DocId uint32 和关键词长度 float32
+//	数值字段   列数 uint32, 每列为列名长度 uint32、列名、有该字段的文档数 uint32 和这些文档在上面的文档顺序中的位置 uint32，
+//	           之后依次为这些文档的值 int64
+//	段         段数 uint32, 每个段依次为段长度 uint64 和段数据，见 segment_file.go
+//
+// 段数据可以直接映射到内存使用，见 LoadFile
+const (
+	indexFileMagic   = "OCTOPUSI"
+	indexFileVersion = 5
+)
+
+var ErrIndexFileVersion = errors.New("索引文件格式或版本不兼容")
+
+var errCorruptedDocValues = errors.New("索引文件中的数值字段已损坏")
+
+// 把索引的当前快照和文档长度写入 w，写入时不阻塞查找
+func (indexer *Indexer) Save(w io.Writer) error {
+	if indexer.initialized == false {
+		log.Fatal("索引器尚未初始化")
+	}
+
+	// 快照和文档长度需要在同一时刻取得
+	indexer.tableLock.Lock()
+	snap := indexer.snapshot()
+	defer snap.release()
+	docIds := make([]uint32, 0, len(indexer.docTokenLengths))
+	for docId := range indexer.docTokenLengths {
+		docIds = append(docIds, docId)
+	}
+	tokenLengths := make([]float32, len(docIds))
+	for i, docId := range docIds {
+		tokenLengths[i] = indexer.docTokenLengths[docId]
+	}
+	names := append([]string(nil), indexer.docValues.names...)
+	positions := make([][]uint32, len(names))
+	columns := make([][]int64, len(names))
+	for i, name := range names {
+		for j, docId := range docIds {
+			ordinal := indexer.docValues.ordinals[docId]
+			if indexer.docValues.present[name].Contains(ordinal) {
+				positions[i] = append(positions[i], uint32(j))
+				columns[i] = append(columns[i], indexer.docValues.columns[name][ordinal])
+			}
+		}
+	}
+	indexer.tableLock.Unlock()
+
+	writer := &indexWriter{w: bufio.NewWriter(w)}
+	writer.bytes([]byte(indexFileMagic))
+	writer.uint32(indexFileVersion)
+
+	writer.uint32(uint32(len(docIds)))
+	for i, docId := range docIds {
+		writer.uint32(docId)
+		writer.float32(tokenLengths[i])
+	}
+
+	writer.uint32(uint32(len(names)))
+	for i, name := range names {
+		writer.uint32(uint32(len(name)))
+		writer.bytes([]byte(name))
+		writer.uint32s(positions[i])
+		for _, value := range columns[i] {
+			writer.uint64(uint64(value))
+		}
+	}
+
+	writer.uint32(uint32(len(snap.segments)))
+	for i, seg := range snap.segments {
+		writeSegment(writer, seg, snap.deleted[i])
+	}
+	if writer.err != nil {
+		return writer.err
+	}
+	return writer.w.Flush()
+}
+
+// 从 r 读入 Save 写入的索引，替换索引器中的全部内容
+// 应在 Init 之后、加入任何文档之前调用
+func (indexer *Indexer) Load(r io.Reader) error {
+	if indexer.initialized == false {
+		log.Fatal("索引器尚未初始化")
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	mapping := &fileMapping{data: data, references: 1}
+	defer mapping.release()
+	return indexer.load(mapping)
+}
+
+// 把 Save 写入的索引文件映射到内存，替换索引器中的全部内容
+// 词典和倒排表直接在映射的文件上读取，由操作系统按需换入，文件在使用期间可以被删除
+// 应在 Init 之后、加入任何文档之前调用
+func (indexer *Indexer) LoadFile(path string) error {
+	if indexer.initialized == false {
+		log.Fatal("索引器尚未初始化")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	mapping, err := mapFile(file)
+	if err != nil {
+		return err
+	}
+	// 载入后由快照持有映射，载入失败时解除映射
+	defer mapping.release()
+	return indexer.load(mapping)
+}
+
+func (indexer *Indexer) load(mapping *fileMapping) error {
+	reader := &byteReader{data: mapping.data}
+	if string(reader.bytes(len(indexFileMagic))) != indexFileMagic || reader.uint32() != indexFileVersion {
+		return ErrIndexFileVersion
+	}
+
+	numDocuments := reader.uint32()
+	docTokenLengths := make(map[uint32]float32)
+	var totalTokenLength float32
+	var values docValues
+	values.init()
+	for i := uint32(0); i < numDocuments && reader.err == nil; i++ {
+		docId := reader.uint32()
+		docTokenLengths[docId] = reader.float32()
+		totalTokenLength += docTokenLengths[docId]
+		values.ordinals[docId] = i
+		values.docIds = append(values.docIds, docId)
+	}
+
+	// 读入时文档的序号就是它在文档顺序中的位置
+	numColumns := reader.uint32()
+	for i := uint32(0); i < numColumns && reader.err == nil; i++ {
+		name := string(reader.bytes(int(reader.uint32())))
+		column := make([]int64, len(values.docIds))
+		present := NewBitmap()
+		for _, position := range reader.uint32s() {
+			if position >= uint32(len(column)) {
+				return errCorruptedDocValues
+			}
+			column[position] = int64(reader.uint64())
+			present.Add(position)
+		}
+		values.names = append(values.names, name)
+		values.columns[name] = column
+		values.present[name] = present
+	}
+
+	snap := &indexSnapshot{}
+	numSegments := reader.uint32()
+	for i := uint32(0); i < numSegments && reader.err == nil; i++ {
+		data := reader.bytes(int(reader.uint64()))
+		if reader.err != nil {
+			break
+		}
+		seg, deleted, err := parseSegment(mapping, data)
+		if err != nil {
+			return err
+		}
+		snap.segments = append(snap.segments, seg)
+		snap.deleted = append(snap.deleted, deleted)
+	}
+	if reader.err != nil {
+		return reader.err
+	}
+
+	indexer.tableLock.Lock()
+	indexer.docValues.Lock()
+	indexer.docTokenLengths = docTokenLengths
+	indexer.totalTokenLength = totalTokenLength
+	atomic.StoreUint32(&indexer.numDocuments, numDocuments)
+	indexer.docValues.ordinals = values.ordinals
+	indexer.docValues.docIds = values.docIds
+	indexer.docValues.free = nil
+	indexer.docValues.names = values.names
+	indexer.docValues.columns = values.columns
+	indexer.docValues.present = values.present
+	indexer.publish(snap)
+	indexer.docValues.Unlock()
+	indexer.tableLock.Unlock()
+	return nil
+}
+
+// 顺序写入索引文件，出错后忽略之后的写入，错误保存在 err 中
+type indexWriter struct {
+	w      *bufio.Writer
+	err    error
+	buffer [8]byte
+}
+
+func (writer *indexWriter) bytes(b []byte) {
+	if writer.err == nil {
+		_, writer.err = writer.w.Write(b)
+	}
+}
+
+func (writer *indexWriter) uint32(v uint32) {
+	binary.LittleEndian.PutUint32(writer.buffer[:], v)
+	writer.bytes(writer.buffer[:4])
+}
+
+func (writer *indexWriter) uint64(v uint64) {
+	binary.LittleEndian.PutUint64(writer.buffer[:], v)
+	writer.bytes(writer.buffer[:])
+}
+
+func (writer *indexWriter) float32(v float32) {
+	writer.uint32(math.Float32bits(v))
+}
+
+func (writer *indexWriter) uint32s(values []uint32) {
+	writer.uint32(uint32(len(values)))
+	for _, v := range values {
+		writer.uint32(v)
+	}
+}
+
+// 顺序读取索引文件的数据，越界后之后的读取都返回零值，错误保存在 err 中
+// 读出的字节切片直接指向 data，不复制
+type byteReader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (reader *byteReader) bytes(n int) []byte {
+	if reader.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(reader.data)-reader.offset {
+		reader.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := reader.data[reader.offset : reader.offset+n]
+	reader.offset += n
+	return b
+}
+
+func (reader *byteReader) uint32() uint32 {
+	if b := reader.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (reader *byteReader) uint64() uint64 {
+	if b := reader.bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (reader *byteReader) float32() float32 {
+	return math.Float32frombits(reader.uint32())
+}
+
+func (reader *byteReader) uint32s() []uint32 {
+	n := reader.uint32()
+	var values []uint32
+	for i := uint32(0); i < n && reader.err == nil; i++ {
+		values = append(values, reader.uint32())
+	}
+	return values
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/huichen/wukong/utils"
+	"octopus/types"
+	"os"
+	"testing"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	var indexer Indexer
+	indexer.Init(IndexerInitOptions{})
+	indexer.AddDocumentToCache(&types.DocumentIndex{
+		DocId:       1,
+		TokenLength: 2,
+		Keywords:    []types.Keyword{{Word: "男朋友", Weight: 1}, {Word: "恋爱", Weight: 0.5}},
+	}, true)
+	indexer.AddDocumentToCache(&types.DocumentIndex{
+		DocId:       2,
+		TokenLength: 3,
+		Keywords:    []types.Keyword{{Word: "恋爱", Weight: 0.8}},
+	}, true)
+	// 替换文档 1，旧段中留下已删除的文档
+	indexer.AddDocumentToCache(&types.DocumentIndex{
+		DocId:       1,
+		TokenLength: 1,
+		Keywords:    []types.Keyword{{Word: "恋爱", Weight: 1}},
+	}, true)
+
+	var buffer bytes.Buffer
+	utils.Expect(t, "<nil>", indexer.Save(&buffer))
+
+	var loaded Indexer
+	loaded.Init(IndexerInitOptions{})
+	utils.Expect(t, "<nil>", loaded.Load(&buffer))
+	utils.Expect(t, "[{1 1} {2 0.80078125}]", loaded.Lookup([]string{"恋爱"}))
+	utils.Expect(t, "0", len(loaded.Lookup([]string{"男朋友"})))
+	utils.Expect(t, "[{恋爱 2}]", loaded.PrefixKeywords(""))
+	utils.Expect(t, "2", loaded.numDocuments)
+	utils.Expect(t, "4", loaded.totalTokenLength)
+
+	var broken Indexer
+	broken.Init(IndexerInitOptions{})
+	utils.Expect(t, ErrIndexFileVersion.Error(), broken.Load(bytes.NewBufferString("OCTOPUSX\x01\x00\x00\x00")))
+}
+
+func TestMappedSegments(t *testing.T) {
+	folder := t.TempDir()
+	var indexer Indexer
+	indexer.Init(IndexerInitOptions{DocCacheSize: 2, MergeFactor: 2, MappedSegmentFolder: folder})
+	for docId := uint32(1); docId <= 4; docId++ {
+		indexer.AddDocumentToCache(&types.DocumentIndex{
+			DocId:       docId,
+			TokenLength: 1,
+			Keywords:    []types.Keyword{{Word: "恋爱", Weight: float32(docId)}},
+		}, false)
+	}
+	for indexer.mergeOnce() {
+	}
+
+	// 合并后的段映射到内存，临时文件已被删除
+	snap := indexer.snapshot()
+	utils.Expect(t, "1", len(snap.segments))
+	utils.Expect(t, "true", snap.segments[0].file != nil)
+	mapping := snap.segments[0].file.mapping
+	// 当前快照和 snap 都使用这个映射，但只持有一个映射的引用
+	utils.Expect(t, "1", mapping.references)
+	files, _ := os.ReadDir(folder)
+	utils.Expect(t, "0", len(files))
+	docs := indexer.Lookup([]string{"恋爱"})
+	utils.Expect(t, "4", len(docs))
+	utils.Expect(t, fmt.Sprint(docs[:2]), indexer.LookupTopK([][]types.QueryToken{{{Word: "恋爱", Weight: 1}}}, 2, nil))
+
+	path := folder + "/index"
+	file, _ := os.Create(path)
+	utils.Expect(t, "<nil>", indexer.Save(file))
+	file.Close()
+	var loaded Indexer
+	loaded.Init(IndexerInitOptions{})
+	utils.Expect(t, "<nil>", loaded.LoadFile(path))
+	utils.Expect(t, fmt.Sprint(docs), loaded.Lookup([]string{"恋爱"}))
+	utils.Expect(t, "[{恋爱 4}]", loaded.PrefixKeywords("恋"))
+
+	// 映射的段被合并掉后，仍在使用的旧快照可以读取，旧快照释放后才解除映射
+	for docId := uint32(5); docId <= 8; docId++ {
+		indexer.AddDocumentToCache(&types.DocumentIndex{
+			DocId:       docId,
+			TokenLength: 1,
+			Keywords:    []types.Keyword{{Word: "恋爱", Weight: 1}},
+		}, false)
+	}
+	for indexer.mergeOnce() {
+	}
+	utils.Expect(t, "true", segmentPosition(indexer.currentSnapshot().segments, snap.segments[0]) < 0)
+	utils.Expect(t, "1", mapping.references)
+	utils.Expect(t, "4", snap.segments[0].indicesAt(0).length)
+	snap.release()
+	utils.Expect(t, "0", mapping.references)
+	utils.Expect(t, "8", len(indexer.Lookup([]string{"恋爱"})))
+}
+
+func TestCorruptedSegment(t *testing.T) {
+	var buffer bytes.Buffer
+	writer := &indexWriter{w: bufio.NewWriter(&buffer)}
+	writeSegment(writer, newSegment(types.DocumentsIndex{
+		{DocId: 1, Keywords: []types.Keyword{{Word: "恋爱", Weight: 1}}},
+	}), nil)
+	writer.w.Flush()
+	data := buffer.Bytes()[8:]
+	_, _, err := parseSegment(&fileMapping{}, data)
+	utils.Expect(t, "<nil>", err)
+
+	// 块头在文档、词典项和关键词之后
+	header := 12 + 4 + dictionaryEntrySize + len("恋爱")
+	corrupt := func(offset int, value uint32) error {
+		corrupted := append([]byte(nil), data...)
+		binary.LittleEndian.PutUint32(corrupted[header+offset:], value)
+		_, _, err := parseSegment(&fileMapping{}, corrupted)
+		return err
+	}
+	utils.Expect(t, errCorruptedSegment.Error(), corrupt(8, 0))
+	utils.Expect(t, errCorruptedSegment.Error(), corrupt(8, postingBlockSize+1))
+	utils.Expect(t, errCorruptedSegment.Error(), corrupt(16, 1000))
+	utils.Expect(t, errCorruptedSegment.Error(), corrupt(20, 1000))
+	_, _, err = parseSegment(&fileMapping{}, data[:len(data)-1])
+	utils.Expect(t, errCorruptedSegment.Error(), err)
+}
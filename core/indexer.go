@@ -5,16 +5,19 @@ import (
 	"log"
 	"octopus/types"
 	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 type Indexer struct {
-	// 从搜索键到文档列表的反向索引
-	// 加了读写锁以保证读写安全
-	tableLock struct {
-		sync.RWMutex
-		table map[string]*KeywordIndices
-	}
+	// 从搜索键到文档列表的反向索引，由若干不可变的段组成，每个未删除的文档只在一个段中
+	// 保存当前的 *indexSnapshot，查找时直接读取，加入文档和合并段时复制出新快照后替换
+	current atomic.Value
+
+	// 生成新快照时持有，保证写入依次进行，查找不需要加锁
+	tableLock sync.Mutex
+
 	addCacheLock struct {
 		sync.RWMutex
 		addCachePointer uint32
@@ -24,20 +27,33 @@ type Indexer struct {
 	initOptions IndexerInitOptions
 	initialized bool
 
-	// 这实际上是总文档数的一个近似
+	// 正在后台合并的段，在 tableLock 保护下读写
+	merging map[*segment]bool
+
+	// 有新段加入时通知后台合并协程
+	mergeChannel chan bool
+
+	// 未删除的文档数，和 docTokenLengths 中的文档数相同
+	// 在 tableLock 保护下用原子操作修改，读取时不需要加锁
 	numDocuments uint32
 
-	// 所有被索引文本的总关键词数
+	// 所有未删除文档的总关键词数
 	totalTokenLength float32
 
 	// 每个文档的关键词长度
 	docTokenLengths map[uint32]float32
+
+	// 文档的数值字段，和 docTokenLengths 包含相同的文档
+	docValues docValues
 }
 
 // 反向索引表的一行，收集了一个搜索键出现的所有文档，按照DocId从小到大排序。
+// 文档被分成压缩块保存，见 postingBlock
 type KeywordIndices struct {
-	docIds []uint32 // 全部类型都有
-	weight []float32
+	blocks []postingBlock
+
+	// 文档总数
+	length int
 }
 
 // 初始化索引器
@@ -49,19 +65,13 @@ func (indexer *Indexer) Init(options IndexerInitOptions) {
 	indexer.initOptions = options
 	indexer.initialized = true
 
-	indexer.tableLock.table = make(map[string]*KeywordIndices)
 	indexer.addCacheLock.addCache = make([]*types.DocumentIndex, indexer.initOptions.DocCacheSize)
+	indexer.publish(&indexSnapshot{})
 	indexer.docTokenLengths = make(map[uint32]float32)
-}
-
-// 从KeywordIndices中得到第i个文档的DocId
-func (indexer *Indexer) getDocId(ti *KeywordIndices, i uint32) uint32 {
-	return ti.docIds[i]
-}
-
-// 得到KeywordIndices中文档总数
-func (indexer *Indexer) getIndexLength(ti *KeywordIndices) uint32 {
-	return uint32(len(ti.docIds))
+	indexer.docValues.init()
+	indexer.merging = make(map[*segment]bool)
+	indexer.mergeChannel = make(chan bool, 1)
+	go indexer.mergeWorker()
 }
 
 // 向 ADDCACHE 中加入一个文档
@@ -79,102 +89,308 @@ func (indexer *Indexer) AddDocumentToCache(document *types.DocumentIndex, forceU
 		addCachedDocuments := indexer.addCacheLock.addCache[0:indexer.addCacheLock.addCachePointer]
 		indexer.addCacheLock.addCachePointer = 0
 		indexer.addCacheLock.Unlock()
-		sort.Sort(addCachedDocuments)
+		sort.Stable(addCachedDocuments)
 		indexer.AddDocuments(&addCachedDocuments)
 	} else {
 		indexer.addCacheLock.Unlock()
 	}
 }
 
-// 向反向索引表中加入 ADDCACHE 中所有文档
+// 把 ADDCACHE 中所有文档生成一个新段加入反向索引表，文档需按 DocId 从小到大稳定排序
+// 段在锁外生成，加入段后发布新快照，正在进行的查找仍使用旧快照
 func (indexer *Indexer) AddDocuments(documents *types.DocumentsIndex) {
 	if indexer.initialized == false {
 		log.Fatal("索引器尚未初始化")
 	}
-	indexer.tableLock.Lock()
-	defer indexer.tableLock.Unlock()
-	indexPointers := make(map[string]uint32, len(indexer.tableLock.table))
 
-	// DocId 递增顺序遍历插入文档保证索引移动次数最少
+	unique := make(types.DocumentsIndex, 0, len(*documents))
 	for i, document := range *documents {
 		if i < len(*documents)-1 && (*documents)[i].DocId == (*documents)[i+1].DocId {
 			// 如果有重复文档加入，因为稳定排序，只加入最后一个
 			fmt.Println("重复文档:", i)
 			continue
 		}
+		unique = append(unique, document)
+	}
+	if len(unique) == 0 {
+		return
+	}
+	seg := newSegment(unique)
 
-		// 更新文档关键词总长度
-		if document.TokenLength != 0 {
-			indexer.docTokenLengths[document.DocId] = float32(document.TokenLength)
-			indexer.totalTokenLength += document.TokenLength
+	indexer.tableLock.Lock()
+	indexer.docValues.Lock()
+	snap := indexer.currentSnapshot().clone()
+	var replaced []uint32
+	for _, document := range unique {
+		// 已经被索引过的文档在旧的段中标记为删除
+		if tokenLength, found := indexer.docTokenLengths[document.DocId]; found {
+			replaced = append(replaced, document.DocId)
+			indexer.totalTokenLength -= tokenLength
 		}
 
-		for index, keyword := range document.Keywords {
-			indices, foundKeyword := indexer.tableLock.table[keyword.Word]
-			if !foundKeyword {
-				// 如果没找到该搜索键则加入
-				//fmt.Printf("id:%d, keyword:%s, weight:%f\n", document.DocId, keyword.Word, document.Keywords[index].Weight)
-				ti := KeywordIndices{}
-				ti.docIds = []uint32{document.DocId}
-				ti.weight = []float32{document.Keywords[index].Weight}
-				indexer.tableLock.table[keyword.Word] = &ti
-			} else {
-				// 已有索引键
-				position, _ := indexer.searchIndex(
-					indices, indexPointers[keyword.Word], indexer.getIndexLength(indices)-1, document.DocId)
-				indexPointers[keyword.Word] = position
-				indices.docIds = append(indices.docIds, 0)
-				copy(indices.docIds[position+1:], indices.docIds[position:])
-				indices.docIds[position] = document.DocId
-
-				indices.weight = append(indices.weight, 0)
-				copy(indices.weight[position+1:], indices.weight[position:])
-				indices.weight[position] = document.Keywords[index].Weight
-			}
+		// 更新文档关键词总长度和文档总数
+		indexer.docTokenLengths[document.DocId] = document.TokenLength
+		indexer.totalTokenLength += document.TokenLength
+		indexer.docValues.set(document.DocId, document.Fields)
+	}
+	atomic.AddUint32(&indexer.numDocuments, uint32(len(unique)-len(replaced)))
+	snap.deleteDocuments(replaced)
+	snap.segments = append(snap.segments, seg)
+	snap.deleted = append(snap.deleted, NewBitmap())
+	indexer.publish(snap)
+	indexer.docValues.Unlock()
+	indexer.tableLock.Unlock()
+
+	indexer.notifyMerge()
+	fmt.Println("indexer.numDocuments", atomic.LoadUint32(&indexer.numDocuments))
+}
+
+// 从索引中删除文档，ADDCACHE 中尚未加入索引的该文档也被丢弃
+// 文档只在快照中标记为删除，倒排表在后台合并时才被清理
+// 调用者需保证不和加入同一文档的 AddDocumentToCache 并发，引擎中两者都在索引器协程中调用
+func (indexer *Indexer) RemoveDocument(docId uint32) {
+	if indexer.initialized == false {
+		log.Fatal("索引器尚未初始化")
+	}
+
+	indexer.addCacheLock.Lock()
+	pending := indexer.addCacheLock.addCache[:indexer.addCacheLock.addCachePointer]
+	kept := pending[:0]
+	for _, document := range pending {
+		if document.DocId != docId {
+			kept = append(kept, document)
 		}
-		// 更新文章状态和总数
-		indexer.numDocuments++
 	}
-	fmt.Println("indexer.numDocuments", indexer.numDocuments)
+	indexer.addCacheLock.addCachePointer = uint32(len(kept))
+	indexer.addCacheLock.Unlock()
+
+	indexer.tableLock.Lock()
+	tokenLength, found := indexer.docTokenLengths[docId]
+	if found {
+		snap := indexer.currentSnapshot().clone()
+		snap.deleteDocuments([]uint32{docId})
+		indexer.publish(snap)
+		delete(indexer.docTokenLengths, docId)
+		indexer.totalTokenLength -= tokenLength
+		atomic.AddUint32(&indexer.numDocuments, ^uint32(0))
+		indexer.docValues.Lock()
+		indexer.docValues.remove(docId)
+		indexer.docValues.Unlock()
+	}
+	indexer.tableLock.Unlock()
+	if found {
+		indexer.notifyMerge()
+	}
+}
+
+// 清空索引器中的全部文档，包括 ADDCACHE 中尚未加入索引的文档
+// 用于读入检查点失败后从头重建索引，正在进行的查找仍使用原来的快照
+func (indexer *Indexer) Reset() {
+	if indexer.initialized == false {
+		log.Fatal("索引器尚未初始化")
+	}
+
+	indexer.addCacheLock.Lock()
+	indexer.addCacheLock.addCachePointer = 0
+	indexer.addCacheLock.Unlock()
+
+	indexer.tableLock.Lock()
+	indexer.docValues.Lock()
+	indexer.docTokenLengths = make(map[uint32]float32)
+	indexer.totalTokenLength = 0
+	atomic.StoreUint32(&indexer.numDocuments, 0)
+	indexer.docValues.init()
+	indexer.publish(&indexSnapshot{})
+	indexer.docValues.Unlock()
+	indexer.tableLock.Unlock()
+}
+
+// 判断关键词是否为 InternalKeywordPrefixes 中的内部索引项
+func (indexer *Indexer) isInternalKeyword(word string) bool {
+	for _, prefix := range indexer.initOptions.InternalKeywordPrefixes {
+		if strings.HasPrefix(word, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// 索引中未删除的文档数，不包括 ADDCACHE 中的文档，此函数线程安全
+func (indexer *Indexer) NumDocuments() uint32 {
+	return atomic.LoadUint32(&indexer.numDocuments)
+}
+
+// 索引中未删除的全部文档，此函数线程安全
+func (indexer *Indexer) DocIds() []uint32 {
+	indexer.tableLock.Lock()
+	defer indexer.tableLock.Unlock()
+	docIds := make([]uint32, 0, len(indexer.docTokenLengths))
+	for docId := range indexer.docTokenLengths {
+		docIds = append(docIds, docId)
+	}
+	return docIds
+}
+
+// 通知后台合并协程，已有通知未处理时不必重复通知
+func (indexer *Indexer) notifyMerge() {
+	select {
+	case indexer.mergeChannel <- true:
+	default:
+	}
 }
 
 // 查找包含全部搜索键(AND操作)的文档
-// 当docIds不为nil时仅从docIds指定的文档中查找
 func (indexer *Indexer) Lookup(words []string) (docs PairList) {
+	groups := make([][]types.QueryToken, len(words))
+	for i, word := range words {
+		groups[i] = []types.QueryToken{{Word: word, Weight: 1}}
+	}
+	return indexer.LookupGroups(groups, nil)
+}
+
+// 查找满足全部检索词组的文档，组间为 AND 操作，组内为 OR 操作
+// 文档在一个组内的得分取命中检索词中 权重*系数 的最大值，总分为各组得分之和
+// filter 不为 nil 时只返回其中的文档
+func (indexer *Indexer) LookupGroups(groups [][]types.QueryToken, filter *Bitmap) (docs PairList) {
 	if indexer.initialized == false {
 		log.Fatal("索引器尚未初始化")
 	}
 
-	if indexer.numDocuments == 0 {
+	snap := indexer.snapshot()
+	defer snap.release()
+	if len(snap.segments) == 0 || len(groups) == 0 {
 		return
 	}
 
-	indexer.tableLock.RLock()
-	defer indexer.tableLock.RUnlock()
-	//table := make([]*KeywordIndices, len(keywords))
-	table := make(map[uint32]float32)
-	for _, word := range words {
-		indices, found := indexer.tableLock.table[word]
-		if !found {
-			// 当反向索引表中无此搜索键时直接返回
-			return
-		} else {
-			// 否则加入反向表中
-			for index, docId := range indices.docIds {
-				value, ok := table[docId]
-				if ok {
-					table[docId] = value + indices.weight[index]
-				} else {
-					table[docId] = indices.weight[index]
+	var table map[uint32]float32
+	for i, group := range groups {
+		groupTable := make(map[uint32]float32)
+		for j, seg := range snap.segments {
+			deleted := snap.deleted[j]
+			for _, token := range group {
+				indices, found := seg.lookup(token.Word)
+				if !found {
+					continue
 				}
+				indices.forEach(func(docId uint32, weight float32) {
+					if deleted.Contains(docId) || (filter != nil && !filter.Contains(docId)) {
+						return
+					}
+					score := weight * token.Weight
+					if value, ok := groupTable[docId]; !ok || score > value {
+						groupTable[docId] = score
+					}
+				})
 			}
+		}
+		if len(groupTable) == 0 {
+			// 当反向索引表中无此组的任何检索词时直接返回
+			return
+		}
 
+		if i == 0 {
+			table = groupTable
+			continue
+		}
+		for docId, value := range table {
+			if score, ok := groupTable[docId]; ok {
+				table[docId] = value + score
+			} else {
+				delete(table, docId)
+			}
 		}
 	}
 	docs = sortMapByValue(table)
 	return
 }
 
+// 得到包含全部关键词的未删除文档，用于按标签等条件过滤，此函数线程安全
+// words 为空时返回 nil，即不过滤
+func (indexer *Indexer) KeywordBitmap(words []string) (bitmap *Bitmap) {
+	snap := indexer.snapshot()
+	defer snap.release()
+	for i, word := range words {
+		wordBitmap := NewBitmap()
+		for j, seg := range snap.segments {
+			indices, found := seg.lookup(word)
+			if !found {
+				continue
+			}
+			deleted := snap.deleted[j]
+			indices.forEach(func(docId uint32, weight float32) {
+				if !deleted.Contains(docId) {
+					wordBitmap.Add(docId)
+				}
+			})
+		}
+		if i == 0 {
+			bitmap = wordBitmap
+		} else {
+			bitmap = And(bitmap, wordBitmap)
+		}
+	}
+	return
+}
+
+// 反向索引表中的一个关键词及包含它的文档数
+type KeywordFrequency struct {
+	Word      string
+	Frequency int
+}
+
+// 得到包含关键词的文档数，此函数线程安全
+func (indexer *Indexer) DocumentFrequency(word string) (frequency int) {
+	snap := indexer.snapshot()
+	defer snap.release()
+	for i, seg := range snap.segments {
+		if indices, found := seg.lookup(word); found {
+			frequency += seg.frequency(indices, snap.deleted[i])
+		}
+	}
+	return
+}
+
+// 按字典序访问反向索引表中的全部关键词，包括文档已全部删除、尚未在合并中清理的关键词，此函数线程安全
+func (indexer *Indexer) ForEachKeyword(fn func(word string)) {
+	snap := indexer.snapshot()
+	defer snap.release()
+	snap.forEachKeyword(func(word string, postings []keywordPostings) {
+		fn(word)
+	})
+}
+
+// 返回以 prefix 开头的全部搜索键及其文档数，按字典序排列，此函数线程安全
+func (indexer *Indexer) PrefixKeywords(prefix string) []KeywordFrequency {
+	snap := indexer.snapshot()
+	defer snap.release()
+	frequencies := make(map[string]int)
+	for j, seg := range snap.segments {
+		n := seg.numKeywords()
+		i := sort.Search(n, func(i int) bool { return seg.keywordAt(i) >= prefix })
+		for ; i < n; i++ {
+			word := seg.keywordAt(i)
+			if !strings.HasPrefix(word, prefix) {
+				break
+			}
+			frequencies[word] += seg.frequency(seg.indicesAt(i), snap.deleted[j])
+		}
+	}
+	return keywordFrequencies(frequencies)
+}
+
+// 把关键词到文档数的映射转换为按字典序排列的列表
+// 文档已全部删除的关键词不返回
+func keywordFrequencies(frequencies map[string]int) []KeywordFrequency {
+	keywords := make([]KeywordFrequency, 0, len(frequencies))
+	for word, frequency := range frequencies {
+		if frequency > 0 {
+			keywords = append(keywords, KeywordFrequency{Word: word, Frequency: frequency})
+		}
+	}
+	sort.Slice(keywords, func(i, j int) bool { return keywords[i].Word < keywords[j].Word })
+	return keywords
+}
+
 type Pair struct {
 	Key   uint32
 	Value float32
@@ -194,38 +410,3 @@ func sortMapByValue(m map[uint32]float32) PairList {
 	sort.Sort(p)
 	return p
 }
-
-// 二分法查找indices中某文档的索引项
-// 第一个返回参数为找到的位置或需要插入的位置
-// 第二个返回参数标明是否找到
-func (indexer *Indexer) searchIndex(
-	indices *KeywordIndices, start uint32, end uint32, docId uint32) (uint32, bool) {
-	// 特殊情况
-	if indexer.getIndexLength(indices) == start {
-		return start, false
-	}
-	if docId < indexer.getDocId(indices, start) {
-		return start, false
-	} else if docId == indexer.getDocId(indices, start) {
-		return start, true
-	}
-	if docId > indexer.getDocId(indices, end) {
-		return end + 1, false
-	} else if docId == indexer.getDocId(indices, end) {
-		return end, true
-	}
-
-	// 二分
-	var middle uint32
-	for end-start > 1 {
-		middle = (start + end) / 2
-		if docId == indexer.getDocId(indices, middle) {
-			return middle, true
-		} else if docId > indexer.getDocId(indices, middle) {
-			start = middle
-		} else {
-			end = middle
-		}
-	}
-	return end, false
-}
@@ -5,16 +5,41 @@ const (
 
 	// 默认插入索引表文档 CACHE SIZE
 	defaultDocCacheSize = 100
+
+	// 默认每层段数达到多少时合并
+	defaultMergeFactor = 10
+
+	// 默认已删除文档超过多少比例时重写段
+	defaultMaxDeletedRatio = 0.3
 )
 
 // 初始化索引器选项
 type IndexerInitOptions struct {
-	// 待插入索引表文档 CACHE SIZE
+	// 待插入索引表文档 CACHE SIZE，每次刷新 CACHE 生成一个新段
 	DocCacheSize uint32
+
+	// 段按文档数分层，每层的段数达到 MergeFactor 时在后台合并为一个段
+	MergeFactor uint32
+
+	// 段中已删除的文档超过此比例时在后台单独重写该段，清理倒排表中的已删除文档
+	MaxDeletedRatio float32
+
+	// 不为空时后台合并生成的段写入该目录并映射到内存，词典和倒排表由操作系统按需换入，不占用 Go 堆
+	// 文件映射后即被删除，不需要清理。从检查点读入的索引总是映射到内存，见 Indexer.LoadFile
+	MappedSegmentFolder string
+
+	// 以这些前缀开头的关键词是上层加入的内部索引项，如拼音和二元组，不计入 TopKeywords 和 NumKeywords
+	InternalKeywordPrefixes []string
 }
 
 func (options *IndexerInitOptions) Init() {
 	if options.DocCacheSize == 0 {
 		options.DocCacheSize = defaultDocCacheSize
 	}
+	if options.MergeFactor < 2 {
+		options.MergeFactor = defaultMergeFactor
+	}
+	if options.MaxDeletedRatio <= 0 {
+		options.MaxDeletedRatio = defaultMaxDeletedRatio
+	}
 }
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"github.com/huichen/wukong/utils"
+	"octopus/types"
+	"testing"
+)
+
+func TestAddDocumentReplacesOldKeywords(t *testing.T) {
+	var indexer Indexer
+	indexer.Init(IndexerInitOptions{})
+
+	indexer.AddDocumentToCache(&types.DocumentIndex{
+		DocId:       1,
+		TokenLength: 2,
+		Keywords:    []types.Keyword{{Word: "男", Weight: 1}, {Word: "朋友", Weight: 1}},
+	}, false)
+	indexer.AddDocumentToCache(&types.DocumentIndex{
+		DocId:       2,
+		TokenLength: 1,
+		Keywords:    []types.Keyword{{Word: "朋友", Weight: 1}},
+	}, true)
+	utils.Expect(t, "2", len(indexer.Lookup([]string{"朋友"})))
+
+	// 词典更新后重新索引文档 1
+	indexer.AddDocumentToCache(&types.DocumentIndex{
+		DocId:       1,
+		TokenLength: 1,
+		Keywords:    []types.Keyword{{Word: "男朋友", Weight: 1}},
+	}, true)
+	utils.Expect(t, "[{1 1}]", indexer.Lookup([]string{"男朋友"}))
+	utils.Expect(t, "[{2 1}]", indexer.Lookup([]string{"朋友"}))
+	utils.Expect(t, "0", len(indexer.Lookup([]string{"男"})))
+	utils.Expect(t, "2", indexer.numDocuments)
+	utils.Expect(t, "2", indexer.totalTokenLength)
+}
+
+func TestLookupGroups(t *testing.T) {
+	var indexer Indexer
+	indexer.Init(IndexerInitOptions{})
+	indexer.AddDocumentToCache(&types.DocumentIndex{
+		DocId:    1,
+		Keywords: []types.Keyword{{Word: "男朋友", Weight: 1}, {Word: "恋爱", Weight: 0.5}},
+	}, false)
+	indexer.AddDocumentToCache(&types.DocumentIndex{
+		DocId:    2,
+		Keywords: []types.Keyword{{Word: "男友", Weight: 1}, {Word: "恋爱", Weight: 0.8}},
+	}, false)
+	indexer.AddDocumentToCache(&types.DocumentIndex{
+		DocId:    3,
+		Keywords: []types.Keyword{{Word: "男友", Weight: 1}},
+	}, true)
+
+	groups := [][]types.QueryToken{
+		{{Word: "男朋友", Weight: 1}, {Word: "男友", Weight: 0.5}},
+		{{Word: "恋爱", Weight: 1}},
+	}
+	// 文档 2 的 "恋爱" 权重 0.8 保存为 bfloat16，有微小误差
+	utils.Expect(t, "[{1 1.5} {2 1.3007812}]", indexer.LookupGroups(groups, nil))
+	utils.Expect(t, "[{2 1.3007812}]", indexer.LookupGroups(groups, BitmapOf(2, 3)))
+}
+
+func TestPrefixKeywords(t *testing.T) {
+	var indexer Indexer
+	indexer.Init(IndexerInitOptions{})
+	indexer.AddDocumentToCache(&types.DocumentIndex{
+		DocId:    1,
+		Keywords: []types.Keyword{{Word: "男朋友", Weight: 1}, {Word: "男人", Weight: 1}},
+	}, false)
+	indexer.AddDocumentToCache(&types.DocumentIndex{
+		DocId:    2,
+		Keywords: []types.Keyword{{Word: "男朋友", Weight: 1}, {Word: "女朋友", Weight: 1}},
+	}, true)
+	utils.Expect(t, "[{男人 1} {男朋友 2}]", indexer.PrefixKeywords("男"))
+
+	indexer.AddDocumentToCache(&types.DocumentIndex{
+		DocId:    1,
+		Keywords: []types.Keyword{{Word: "男朋友", Weight: 1}},
+	}, true)
+	utils.Expect(t, "[{男朋友 2}]", indexer.PrefixKeywords("男"))
+	utils.Expect(t, "[]", indexer.PrefixKeywords("男孩"))
+}
+
+func TestMergeSegments(t *testing.T) {
+	var indexer Indexer
+	indexer.Init(IndexerInitOptions{DocCacheSize: 2, MergeFactor: 2})
+	for docId := uint32(1); docId <= 8; docId++ {
+		indexer.AddDocumentToCache(&types.DocumentIndex{
+			DocId:       docId,
+			TokenLength: 1,
+			Keywords:    []types.Keyword{{Word: "恋爱", Weight: float32(docId)}},
+		}, false)
+	}
+	// 替换一个已在段中的文档
+	indexer.AddDocumentToCache(&types.DocumentIndex{
+		DocId:       3,
+		TokenLength: 1,
+		Keywords:    []types.Keyword{{Word: "朋友", Weight: 1}},
+	}, true)
+	for indexer.mergeOnce() {
+	}
+
+	// 全部段都在第 0 层，最终合并为一个段，旧版本的文档 3 被清除
+	snap := indexer.snapshot()
+	defer snap.release()
+	utils.Expect(t, "1", len(snap.segments))
+	utils.Expect(t, "[1 2 3 4 5 6 7 8]", snap.segments[0].docIds)
+	utils.Expect(t, "0", snap.deleted[0].Cardinality())
+	utils.Expect(t, "7", len(indexer.Lookup([]string{"恋爱"})))
+	utils.Expect(t, "[{3 1}]", indexer.Lookup([]string{"朋友"}))
+	utils.Expect(t, "8", indexer.numDocuments)
+}
+
+func TestSnapshotIsolation(t *testing.T) {
+	var indexer Indexer
+	indexer.Init(IndexerInitOptions{})
+	indexer.AddDocumentToCache(&types.DocumentIndex{
+		DocId:    1,
+		Keywords: []types.Keyword{{Word: "恋爱", Weight: 1}},
+	}, true)
+	old := indexer.snapshot()
+	defer old.release()
+
+	// 替换文档 1 后旧快照不受影响
+	indexer.AddDocumentToCache(&types.DocumentIndex{
+		DocId:    1,
+		Keywords: []types.Keyword{{Word: "朋友", Weight: 1}},
+	}, true)
+	utils.Expect(t, "1", len(old.segments))
+	utils.Expect(t, "0", old.deleted[0].Cardinality())
+	utils.Expect(t, "0", len(indexer.Lookup([]string{"恋爱"})))
+	utils.Expect(t, "[{1 1}]", indexer.Lookup([]string{"朋友"}))
+}
+
+func TestRemoveDocument(t *testing.T) {
+	var indexer Indexer
+	indexer.Init(IndexerInitOptions{MaxDeletedRatio: 0.4})
+	for docId := uint32(1); docId <= 3; docId++ {
+		indexer.AddDocumentToCache(&types.DocumentIndex{
+			DocId:       docId,
+			TokenLength: 1,
+			Keywords:    []types.Keyword{{Word: "恋爱", Weight: 1}},
+		}, docId == 2)
+	}
+	// 文档 3 还在 ADDCACHE 中，删除后不会被加入索引
+	indexer.RemoveDocument(3)
+	indexer.RemoveDocument(1)
+	indexer.AddDocumentToCache(nil, true)
+	utils.Expect(t, "[{2 1}]", indexer.Lookup([]string{"恋爱"}))
+	utils.Expect(t, "[2]", indexer.KeywordBitmap([]string{"恋爱"}).ToArray())
+	utils.Expect(t, "1", indexer.numDocuments)
+
+	// 已删除的文档超过 MaxDeletedRatio，重写该段
+	for indexer.mergeOnce() {
+	}
+	snap := indexer.snapshot()
+	defer snap.release()
+	utils.Expect(t, "[2]", snap.segments[0].docIds)
+	utils.Expect(t, "0", snap.deleted[0].Cardinality())
+}
+
+func TestReset(t *testing.T) {
+	var indexer Indexer
+	indexer.Init(IndexerInitOptions{})
+	for docId := uint32(1); docId <= 2; docId++ {
+		indexer.AddDocumentToCache(&types.DocumentIndex{
+			DocId:    docId,
+			Keywords: []types.Keyword{{Word: "恋爱", Weight: 1}},
+			Fields:   map[string]int64{"time": 1},
+		}, docId == 1)
+	}
+	indexer.Reset()
+	// ADDCACHE 中的文档也被丢弃
+	indexer.AddDocumentToCache(nil, true)
+	utils.Expect(t, "0", len(indexer.Lookup([]string{"恋爱"})))
+	utils.Expect(t, "0", indexer.NumDocuments())
+	utils.Expect(t, "[]", indexer.FieldRangeBitmap("time", 0, 1).ToArray())
+}
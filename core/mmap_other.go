@@ -0,0 +1,24 @@
+//go:build !linux && !darwin && !freebsd
+
+package core
+
+import (
+	"io"
+	"os"
+)
+
+// 不支持 mmap 的系统上把文件读入内存，返回的映射由调用者持有一个引用，见 fileMapping
+func mapFile(file *os.File) (*fileMapping, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	return &fileMapping{data: data, references: 1}, nil
+}
+
+// 数据在 Go 堆中，由 GC 回收
+func unmapFile(mapping *fileMapping) {
+}
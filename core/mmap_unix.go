@@ -0,0 +1,28 @@
+//go:build linux || darwin || freebsd
+
+package core
+
+import (
+	"os"
+	"syscall"
+)
+
+// 把文件只读映射到内存，返回的映射由调用者持有一个引用，见 fileMapping
+func mapFile(file *os.File) (*fileMapping, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		return &fileMapping{references: 1}, nil
+	}
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	return &fileMapping{data: data, references: 1, mapped: true}, nil
+}
+
+func unmapFile(mapping *fileMapping) {
+	syscall.Munmap(mapping.data)
+}
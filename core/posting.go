@@ -0,0 +1,125 @@
+package core
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// 倒排表压缩块中的文档数
+const postingBlockSize = 128
+
+// 倒排表的一个压缩块
+// 块内 DocId 从小到大排列，除第一个外都保存为和前一个 DocId 的差值，用 varint 编码
+// 权重保存为 bfloat16，即 float32 的高 16 位，每个 2 字节，相对误差不超过 1/256
+// 权重的编码和块内其他文档无关，合并段时解码后再编码得到相同的值，文档的得分不会因合并改变
+type postingBlock struct {
+	// 块内第一个和最后一个 DocId，用于跳过不相关的块
+	firstDocId uint32
+	lastDocId  uint32
+
+	// 块内文档数
+	length int
+
+	// 块内解码后的最大权重，用于估计得分上限
+	maxWeight float32
+
+	deltas  []byte
+	weights []byte
+}
+
+// 把按 DocId 从小到大排列的文档编码为一个压缩块
+func encodePostingBlock(docIds []uint32, weights []float32) postingBlock {
+	block := postingBlock{
+		firstDocId: docIds[0],
+		lastDocId:  docIds[len(docIds)-1],
+		length:     len(docIds),
+		weights:    make([]byte, 2*len(weights)),
+	}
+
+	buffer := make([]byte, binary.MaxVarintLen32*(len(docIds)-1))
+	size := 0
+	for i := 1; i < len(docIds); i++ {
+		size += binary.PutUvarint(buffer[size:], uint64(docIds[i]-docIds[i-1]))
+	}
+	block.deltas = make([]byte, size)
+	copy(block.deltas, buffer[:size])
+
+	for i, weight := range weights {
+		quantized := quantizeWeight(weight)
+		binary.LittleEndian.PutUint16(block.weights[2*i:], quantized)
+		if weight := dequantizeWeight(quantized); weight > block.maxWeight {
+			block.maxWeight = weight
+		}
+	}
+	return block
+}
+
+// 把块解码后追加到 docIds 和 weights 之后
+func (block *postingBlock) decode(docIds []uint32, weights []float32) ([]uint32, []float32) {
+	docId := block.firstDocId
+	docIds = append(docIds, docId)
+	offset := 0
+	for i := 1; i < block.length; i++ {
+		delta, size := binary.Uvarint(block.deltas[offset:])
+		offset += size
+		docId += uint32(delta)
+		docIds = append(docIds, docId)
+	}
+	for i := 0; i < block.length; i++ {
+		weights = append(weights, dequantizeWeight(binary.LittleEndian.Uint16(block.weights[2*i:])))
+	}
+	return docIds, weights
+}
+
+// 块占用的字节数估计
+func (block *postingBlock) byteSize() int {
+	return 32 + len(block.deltas) + len(block.weights)
+}
+
+// 把权重舍入为 bfloat16，小于等于 0 的权重保存为 0
+func quantizeWeight(weight float32) uint16 {
+	if !(weight > 0) {
+		return 0
+	}
+	bits := math.Float32bits(weight)
+	// 舍入到最近，恰在中间时舍入到偶数
+	bits += 0x7fff + (bits>>16)&1
+	return uint16(bits >> 16)
+}
+
+func dequantizeWeight(weight uint16) float32 {
+	return math.Float32frombits(uint32(weight) << 16)
+}
+
+// 依次对倒排表中的每个文档调用 fn，DocId 从小到大
+func (indices *KeywordIndices) forEach(fn func(docId uint32, weight float32)) {
+	var docIds []uint32
+	var weights []float32
+	for i := range indices.blocks {
+		docIds, weights = indices.blocks[i].decode(docIds[:0], weights[:0])
+		for j, docId := range docIds {
+			fn(docId, weights[j])
+		}
+	}
+}
+
+// 用按 DocId 从小到大排列的文档生成倒排表
+func newKeywordIndices(docIds []uint32, weights []float32) *KeywordIndices {
+	indices := &KeywordIndices{length: len(docIds)}
+	for start := 0; start < len(docIds); start += postingBlockSize {
+		end := start + postingBlockSize
+		if end > len(docIds) {
+			end = len(docIds)
+		}
+		indices.blocks = append(indices.blocks, encodePostingBlock(docIds[start:end], weights[start:end]))
+	}
+	return indices
+}
+
+// 倒排表占用的字节数估计
+func (indices *KeywordIndices) byteSize() (size int) {
+	for i := range indices.blocks {
+		size += indices.blocks[i].byteSize()
+	}
+	return
+}
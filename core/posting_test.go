@@ -0,0 +1,121 @@
+package core
+
+import (
+	"fmt"
+	"github.com/huichen/wukong/utils"
+	"math/rand"
+	"testing"
+)
+
+func TestKeywordIndicesRoundTrip(t *testing.T) {
+	docIds := make([]uint32, 1000)
+	weights := make([]float32, 1000)
+	for i := range docIds {
+		docIds[i] = uint32(i*3 + 1)
+		weights[i] = 1
+	}
+	weights[1] = 0.5
+	indices := newKeywordIndices(docIds, weights)
+	utils.Expect(t, "1000", indices.length)
+	utils.Expect(t, "8", len(indices.blocks))
+
+	var decodedDocIds []uint32
+	var decodedWeights []float32
+	indices.forEach(func(docId uint32, weight float32) {
+		decodedDocIds = append(decodedDocIds, docId)
+		decodedWeights = append(decodedWeights, weight)
+	})
+	utils.Expect(t, fmt.Sprint(docIds), decodedDocIds)
+	utils.Expect(t, "[1 0.5 1]", decodedWeights[:3])
+
+	// 解码后的权重再次编码不变，合并段不会改变文档的得分
+	for i := range weights {
+		weights[i] = rand.Float32() * 10
+	}
+	once := newKeywordIndices(docIds, weights)
+	decodedWeights = decodedWeights[:0]
+	once.forEach(func(docId uint32, weight float32) {
+		decodedWeights = append(decodedWeights, weight)
+	})
+	twice := newKeywordIndices(docIds, decodedWeights)
+	i := 0
+	twice.forEach(func(docId uint32, weight float32) {
+		utils.Expect(t, fmt.Sprint(decodedWeights[i]), weight)
+		i++
+	})
+}
+
+// 压缩前的倒排表布局，用于对比
+type rawKeywordIndices struct {
+	docIds []uint32
+	weight []float32
+}
+
+const (
+	benchmarkNumDocuments = 200000
+	benchmarkNumKeywords  = 100
+)
+
+// 生成测试用的倒排表，第 k 个关键词大约出现在 1/(k+1) 的文档中
+func benchmarkPostings() [][]uint32 {
+	random := rand.New(rand.NewSource(1))
+	postings := make([][]uint32, benchmarkNumKeywords)
+	for k := range postings {
+		for docId := uint32(1); docId <= benchmarkNumDocuments; docId++ {
+			if random.Intn(k+1) == 0 {
+				postings[k] = append(postings[k], docId)
+			}
+		}
+	}
+	return postings
+}
+
+func BenchmarkRawPostings(b *testing.B) {
+	postings := benchmarkPostings()
+	table := make([]rawKeywordIndices, len(postings))
+	bytes := 0
+	for k, docIds := range postings {
+		table[k].docIds = docIds
+		table[k].weight = make([]float32, len(docIds))
+		for i := range docIds {
+			table[k].weight[i] = rand.Float32()
+		}
+		bytes += 48 + 8*len(docIds)
+	}
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		scores := make(map[uint32]float32)
+		for _, k := range []int{0, 3, 30} {
+			for i, docId := range table[k].docIds {
+				scores[docId] += table[k].weight[i]
+			}
+		}
+	}
+	b.ReportMetric(float64(bytes), "index-bytes")
+}
+
+func BenchmarkCompressedPostings(b *testing.B) {
+	postings := benchmarkPostings()
+	table := make([]KeywordIndices, len(postings))
+	bytes := 0
+	for k, docIds := range postings {
+		weights := make([]float32, len(docIds))
+		for i := range docIds {
+			weights[i] = rand.Float32()
+		}
+		table[k] = *newKeywordIndices(docIds, weights)
+		bytes += 32 + table[k].byteSize()
+	}
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		scores := make(map[uint32]float32)
+		for _, k := range []int{0, 3, 30} {
+			table[k].forEach(func(docId uint32, weight float32) {
+				scores[docId] += weight
+			})
+		}
+	}
+	b.ReportMetric(float64(bytes), "index-bytes")
+}
@@ -0,0 +1,290 @@
+package core
+
+import (
+	"fmt"
+	"octopus/types"
+	"sort"
+)
+
+// 不可变的索引段，由一批文档生成或由几个较小的段合并而成
+// 段内已删除的文档记录在快照中，见 indexSnapshot
+// 段可以在内存中，也可以保存在映射到内存的索引文件中，应通过 lookup 等方法访问关键词
+type segment struct {
+	// 反向索引表，只用于内存中的段
+	table map[string]*KeywordIndices
+
+	// 按字典序排列的全部搜索键，用于前缀查找，只用于内存中的段
+	keywords []string
+
+	// 段内全部文档，按 DocId 从小到大排列，包括已删除的文档
+	docIds []uint32
+
+	// 不为 nil 时段保存在索引文件中，见 segment_file.go
+	file *segmentFile
+}
+
+// 一个搜索键的未压缩倒排表，按 DocId 排序后编码为 KeywordIndices
+type postingList struct {
+	docIds  []uint32
+	weights []float32
+}
+
+func (list *postingList) Len() int           { return len(list.docIds) }
+func (list *postingList) Less(i, j int) bool { return list.docIds[i] < list.docIds[j] }
+func (list *postingList) Swap(i, j int) {
+	list.docIds[i], list.docIds[j] = list.docIds[j], list.docIds[i]
+	list.weights[i], list.weights[j] = list.weights[j], list.weights[i]
+}
+
+// 用按 DocId 从小到大排列且没有重复的一批文档生成段
+func newSegment(documents types.DocumentsIndex) *segment {
+	lists := make(map[string]*postingList)
+	docIds := make([]uint32, len(documents))
+	for i, document := range documents {
+		docIds[i] = document.DocId
+		for _, keyword := range document.Keywords {
+			list, found := lists[keyword.Word]
+			if !found {
+				list = &postingList{}
+				lists[keyword.Word] = list
+			}
+			list.docIds = append(list.docIds, document.DocId)
+			list.weights = append(list.weights, keyword.Weight)
+		}
+	}
+	return buildSegment(lists, docIds)
+}
+
+// 合并几个段，已删除的文档不会出现在新段中
+// deleted[i] 是 segments[i] 在合并开始时的已删除文档
+func mergeSegments(segments []*segment, deleted []*Bitmap) *segment {
+	lists := make(map[string]*postingList)
+	var docIds []uint32
+	for i, seg := range segments {
+		for _, docId := range seg.docIds {
+			if !deleted[i].Contains(docId) {
+				docIds = append(docIds, docId)
+			}
+		}
+		for k := 0; k < seg.numKeywords(); k++ {
+			word, indices := seg.keywordAt(k), seg.indicesAt(k)
+			list, found := lists[word]
+			if !found {
+				list = &postingList{}
+				lists[word] = list
+			}
+			indices.forEach(func(docId uint32, weight float32) {
+				if !deleted[i].Contains(docId) {
+					list.docIds = append(list.docIds, docId)
+					list.weights = append(list.weights, weight)
+				}
+			})
+		}
+	}
+
+	// 各段的 DocId 范围互相交叠，需要重新排序
+	sort.Slice(docIds, func(i, j int) bool { return docIds[i] < docIds[j] })
+	for word, list := range lists {
+		if len(list.docIds) == 0 {
+			delete(lists, word)
+			continue
+		}
+		sort.Sort(list)
+	}
+	return buildSegment(lists, docIds)
+}
+
+func buildSegment(lists map[string]*postingList, docIds []uint32) *segment {
+	seg := &segment{
+		table:    make(map[string]*KeywordIndices, len(lists)),
+		keywords: make([]string, 0, len(lists)),
+		docIds:   docIds,
+	}
+	for word, list := range lists {
+		seg.table[word] = newKeywordIndices(list.docIds, list.weights)
+		seg.keywords = append(seg.keywords, word)
+	}
+	sort.Strings(seg.keywords)
+	return seg
+}
+
+// 得到关键词的倒排表
+func (seg *segment) lookup(word string) (*KeywordIndices, bool) {
+	if seg.file != nil {
+		return seg.file.lookup(word)
+	}
+	indices, found := seg.table[word]
+	return indices, found
+}
+
+// 段内的关键词数
+func (seg *segment) numKeywords() int {
+	if seg.file != nil {
+		return seg.file.numKeywords
+	}
+	return len(seg.keywords)
+}
+
+// 按字典序的第 i 个关键词
+func (seg *segment) keywordAt(i int) string {
+	if seg.file != nil {
+		return seg.file.keyword(i)
+	}
+	return seg.keywords[i]
+}
+
+// 按字典序的第 i 个关键词的倒排表
+func (seg *segment) indicesAt(i int) *KeywordIndices {
+	if seg.file != nil {
+		return seg.file.indices(i)
+	}
+	return seg.table[seg.keywords[i]]
+}
+
+// 判断段内是否有该文档（包括已删除的）
+func (seg *segment) contains(docId uint32) bool {
+	i := sort.Search(len(seg.docIds), func(i int) bool { return seg.docIds[i] >= docId })
+	return i < len(seg.docIds) && seg.docIds[i] == docId
+}
+
+// 段内包含关键词且未删除的文档数，段内有已删除文档时需要解码倒排表
+func (seg *segment) frequency(indices *KeywordIndices, deleted *Bitmap) (frequency int) {
+	if deleted.Cardinality() == 0 {
+		return indices.length
+	}
+	indices.forEach(func(docId uint32, weight float32) {
+		if !deleted.Contains(docId) {
+			frequency++
+		}
+	})
+	return
+}
+
+// 段内未删除的文档数
+func (seg *segment) numLiveDocuments(deleted *Bitmap) int {
+	return len(seg.docIds) - deleted.Cardinality()
+}
+
+// 合并策略：按未删除的文档数把段分层，第 n 层的段有 [DocCacheSize*MergeFactor^n, DocCacheSize*MergeFactor^(n+1)) 个文档
+// 某一层的段数达到 MergeFactor 时合并该层中的这些段，返回需要合并的段在快照中的位置，没有时返回 nil
+// 调用者需持有 tableLock，merging 中的段不参与合并
+func (indexer *Indexer) findMerge(snap *indexSnapshot) []int {
+	tiers := make(map[int][]int)
+	lowestTier := -1
+	for i, seg := range snap.segments {
+		if indexer.merging[seg] {
+			continue
+		}
+		tier := 0
+		size := indexer.initOptions.DocCacheSize * indexer.initOptions.MergeFactor
+		for uint32(seg.numLiveDocuments(snap.deleted[i])) >= size {
+			size *= indexer.initOptions.MergeFactor
+			tier++
+		}
+		tiers[tier] = append(tiers[tier], i)
+		if len(tiers[tier]) >= int(indexer.initOptions.MergeFactor) && (lowestTier < 0 || tier < lowestTier) {
+			lowestTier = tier
+		}
+	}
+	if lowestTier >= 0 {
+		return tiers[lowestTier][:indexer.initOptions.MergeFactor]
+	}
+
+	// 没有需要合并的层时，单独重写已删除文档过多的段以清理倒排表
+	for i, seg := range snap.segments {
+		if !indexer.merging[seg] &&
+			float32(snap.deleted[i].Cardinality()) > indexer.initOptions.MaxDeletedRatio*float32(len(seg.docIds)) {
+			return []int{i}
+		}
+	}
+	return nil
+}
+
+// 后台合并协程，每次有新段加入时检查是否需要合并
+func (indexer *Indexer) mergeWorker() {
+	for range indexer.mergeChannel {
+		for indexer.mergeOnce() {
+		}
+	}
+}
+
+// 按合并策略做一次合并，没有需要合并的段时返回 false
+// 合并在锁外进行，期间查找和加入文档不受影响
+func (indexer *Indexer) mergeOnce() bool {
+	indexer.tableLock.Lock()
+	snap := indexer.currentSnapshot()
+	positions := indexer.findMerge(snap)
+	if positions == nil {
+		indexer.tableLock.Unlock()
+		return false
+	}
+	// 合并期间持有快照，被合并的段中映射的数据不会被解除映射
+	// 快照中的删除表不会被修改，合并时可以直接读取
+	snap.acquire()
+	segments := make([]*segment, len(positions))
+	deleted := make([]*Bitmap, len(positions))
+	for i, position := range positions {
+		segments[i] = snap.segments[position]
+		deleted[i] = snap.deleted[position]
+		indexer.merging[segments[i]] = true
+	}
+	indexer.tableLock.Unlock()
+
+	merged := mergeSegments(segments, deleted)
+	snap.release()
+	if indexer.initOptions.MappedSegmentFolder != "" {
+		// 合并后的段较大，写入文件并映射到内存，不占用 Go 堆
+		if mapped, err := mapSegment(merged, indexer.initOptions.MappedSegmentFolder); err == nil {
+			merged = mapped
+			// 发布新快照后只由快照持有映射
+			defer mapped.file.mapping.release()
+		} else {
+			fmt.Println("无法映射合并后的段:", err)
+		}
+	}
+
+	indexer.tableLock.Lock()
+	defer indexer.tableLock.Unlock()
+	// 用新段替换被合并的段，合并期间被删除的文档在新段中也要删除
+	snap = indexer.currentSnapshot()
+	next := &indexSnapshot{}
+	var mergedDeleted []uint32
+	replaced := 0
+	for i, seg := range snap.segments {
+		j := segmentPosition(segments, seg)
+		if j < 0 {
+			next.segments = append(next.segments, seg)
+			next.deleted = append(next.deleted, snap.deleted[i])
+			continue
+		}
+		snap.deleted[i].ForEach(func(docId uint32) {
+			if !deleted[j].Contains(docId) {
+				mergedDeleted = append(mergedDeleted, docId)
+			}
+		})
+		replaced++
+	}
+	for _, seg := range segments {
+		delete(indexer.merging, seg)
+	}
+	if replaced < len(segments) {
+		// 合并期间索引被 Reset 或 Load 替换，丢弃合并结果
+		return true
+	}
+	if len(merged.docIds) > 0 {
+		next.segments = append(next.segments, merged)
+		next.deleted = append(next.deleted, BitmapOf(mergedDeleted...))
+	}
+	indexer.publish(next)
+	return true
+}
+
+// 段在列表中的位置，不在列表中时返回 -1
+func segmentPosition(segments []*segment, seg *segment) int {
+	for i, s := range segments {
+		if s == seg {
+			return i
+		}
+	}
+	return -1
+}
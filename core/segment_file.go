@@ -0,0 +1,248 @@
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"sort"
+	"sync/atomic"
+)
+
+// 段在索引文件中的格式，数值均为小端序，偏移量都相对于段数据的开头：
+//
+//	文档       文档数 uint32 和各 DocId, 已删除文档数 uint32 和各 DocId
+//	词典       关键词数 uint32, 按字典序排列的各关键词的词典项
+//	关键词     各关键词的字节，词典项中的偏移量指向这里
+//	倒排表     各关键词倒排表的块头，之后是各块的 deltas 和量化权重
+//
+// 词典项和块头都是定长的，查找时直接在文件数据上二分查找和读取，不需要解码整个段
+const (
+	// 关键词偏移量和长度 uint32, 倒排表偏移量 uint64, 文档数 uint32, 块数 uint32
+	dictionaryEntrySize = 24
+
+	// firstDocId, lastDocId, 块内文档数 uint32, maxWeight float32,
+	// deltas 长度 uint32, deltas 偏移量 uint64，每个 2 字节的量化权重紧接在 deltas 之后
+	blockHeaderSize = 28
+)
+
+var errCorruptedSegment = errors.New("索引文件中的段已损坏")
+
+// 映射到内存的索引文件
+// 创建者和每个包含其中的段的快照各持有一个引用，最后一个引用释放时解除映射
+// 倒排块直接指向映射的数据，只能在持有快照期间读取，见 Indexer.snapshot
+type fileMapping struct {
+	data []byte
+
+	references int32
+
+	// 为 false 时 data 在 Go 堆中，不需要解除映射
+	mapped bool
+}
+
+func (mapping *fileMapping) acquire() {
+	atomic.AddInt32(&mapping.references, 1)
+}
+
+func (mapping *fileMapping) release() {
+	if atomic.AddInt32(&mapping.references, -1) == 0 && mapping.mapped {
+		unmapFile(mapping)
+	}
+}
+
+// 保存在索引文件中的段，词典和倒排表直接从文件数据中读取
+type segmentFile struct {
+	mapping *fileMapping
+
+	// 段数据，是 mapping.data 的一部分
+	data []byte
+
+	numKeywords int
+
+	// 词典在段数据中的偏移量
+	dictionary int
+}
+
+// 段数据中第 i 个关键词的字节
+func (file *segmentFile) keywordBytes(i int) []byte {
+	entry := file.data[file.dictionary+i*dictionaryEntrySize:]
+	offset := binary.LittleEndian.Uint32(entry)
+	length := binary.LittleEndian.Uint32(entry[4:])
+	return file.data[offset : offset+length]
+}
+
+func (file *segmentFile) keyword(i int) string {
+	return string(file.keywordBytes(i))
+}
+
+// 读出第 i 个关键词的倒排表，块内数据不复制
+func (file *segmentFile) indices(i int) *KeywordIndices {
+	entry := file.data[file.dictionary+i*dictionaryEntrySize:]
+	offset := binary.LittleEndian.Uint64(entry[8:])
+	indices := &KeywordIndices{
+		blocks: make([]postingBlock, binary.LittleEndian.Uint32(entry[20:])),
+		length: int(binary.LittleEndian.Uint32(entry[16:])),
+	}
+	for j := range indices.blocks {
+		header := file.data[offset+uint64(j)*blockHeaderSize:]
+		block := postingBlock{
+			firstDocId: binary.LittleEndian.Uint32(header),
+			lastDocId:  binary.LittleEndian.Uint32(header[4:]),
+			length:     int(binary.LittleEndian.Uint32(header[8:])),
+			maxWeight:  math.Float32frombits(binary.LittleEndian.Uint32(header[12:])),
+		}
+		deltasLength := uint64(binary.LittleEndian.Uint32(header[16:]))
+		deltas := binary.LittleEndian.Uint64(header[20:])
+		block.deltas = file.data[deltas : deltas+deltasLength]
+		block.weights = file.data[deltas+deltasLength : deltas+deltasLength+2*uint64(block.length)]
+		indices.blocks[j] = block
+	}
+	return indices
+}
+
+func (file *segmentFile) lookup(word string) (*KeywordIndices, bool) {
+	i := sort.Search(file.numKeywords, func(i int) bool { return string(file.keywordBytes(i)) >= word })
+	if i < file.numKeywords && string(file.keywordBytes(i)) == word {
+		return file.indices(i), true
+	}
+	return nil, false
+}
+
+// 段数据占用的字节数，不包括开头的段长度
+func segmentSize(seg *segment, numDeleted int) (size uint64) {
+	size = 12 + 4*uint64(len(seg.docIds)+numDeleted) + dictionaryEntrySize*uint64(seg.numKeywords())
+	for i := 0; i < seg.numKeywords(); i++ {
+		size += uint64(len(seg.keywordAt(i)))
+		indices := seg.indicesAt(i)
+		for j := range indices.blocks {
+			size += blockHeaderSize + uint64(len(indices.blocks[j].deltas)+len(indices.blocks[j].weights))
+		}
+	}
+	return
+}
+
+// 写入段长度 uint64 和段数据，deleted 为段内已删除的文档
+func writeSegment(writer *indexWriter, seg *segment, deleted *Bitmap) {
+	numDeleted := deleted.Cardinality()
+	writer.uint64(segmentSize(seg, numDeleted))
+
+	writer.uint32s(seg.docIds)
+	writer.uint32(uint32(numDeleted))
+	deleted.ForEach(writer.uint32)
+
+	numKeywords := seg.numKeywords()
+	writer.uint32(uint32(numKeywords))
+	wordOffset := 12 + 4*uint64(len(seg.docIds)+numDeleted) + dictionaryEntrySize*uint64(numKeywords)
+	postingsStart := wordOffset
+	for i := 0; i < numKeywords; i++ {
+		postingsStart += uint64(len(seg.keywordAt(i)))
+	}
+	postingsOffset := postingsStart
+	for i := 0; i < numKeywords; i++ {
+		indices := seg.indicesAt(i)
+		writer.uint32(uint32(wordOffset))
+		writer.uint32(uint32(len(seg.keywordAt(i))))
+		writer.uint64(postingsOffset)
+		writer.uint32(uint32(indices.length))
+		writer.uint32(uint32(len(indices.blocks)))
+		wordOffset += uint64(len(seg.keywordAt(i)))
+		postingsOffset += blockHeaderSize * uint64(len(indices.blocks))
+		for j := range indices.blocks {
+			postingsOffset += uint64(len(indices.blocks[j].deltas) + len(indices.blocks[j].weights))
+		}
+	}
+	for i := 0; i < numKeywords; i++ {
+		writer.bytes([]byte(seg.keywordAt(i)))
+	}
+
+	offset := postingsStart
+	for i := 0; i < numKeywords; i++ {
+		indices := seg.indicesAt(i)
+		dataOffset := offset + blockHeaderSize*uint64(len(indices.blocks))
+		for j := range indices.blocks {
+			block := &indices.blocks[j]
+			writer.uint32(block.firstDocId)
+			writer.uint32(block.lastDocId)
+			writer.uint32(uint32(block.length))
+			writer.float32(block.maxWeight)
+			writer.uint32(uint32(len(block.deltas)))
+			writer.uint64(dataOffset)
+			dataOffset += uint64(len(block.deltas) + len(block.weights))
+		}
+		for j := range indices.blocks {
+			writer.bytes(indices.blocks[j].deltas)
+			writer.bytes(indices.blocks[j].weights)
+		}
+		offset = dataOffset
+	}
+}
+
+// 从 data 中读出 writeSegment 写入的段，data 从段数据的开头开始
+func parseSegment(mapping *fileMapping, data []byte) (*segment, *Bitmap, error) {
+	reader := &byteReader{data: data}
+	seg := &segment{docIds: reader.uint32s()}
+	deleted := BitmapOf(reader.uint32s()...)
+	numKeywords := int(reader.uint32())
+	if reader.err != nil || uint64(len(data)-reader.offset) < dictionaryEntrySize*uint64(numKeywords) {
+		return nil, nil, errCorruptedSegment
+	}
+	file := &segmentFile{mapping: mapping, data: data, numKeywords: numKeywords, dictionary: reader.offset}
+
+	// 检查词典项和块头，之后的读取不再检查边界
+	size := uint64(len(data))
+	for i := 0; i < numKeywords; i++ {
+		entry := data[file.dictionary+i*dictionaryEntrySize:]
+		wordEnd := uint64(binary.LittleEndian.Uint32(entry)) + uint64(binary.LittleEndian.Uint32(entry[4:]))
+		offset := binary.LittleEndian.Uint64(entry[8:])
+		numBlocks := uint64(binary.LittleEndian.Uint32(entry[20:]))
+		if wordEnd > size || offset > size || blockHeaderSize*numBlocks > size-offset {
+			return nil, nil, errCorruptedSegment
+		}
+		for j := uint64(0); j < numBlocks; j++ {
+			if !validBlockHeader(data[offset+j*blockHeaderSize:], size) {
+				return nil, nil, errCorruptedSegment
+			}
+		}
+	}
+	seg.file = file
+	return seg, deleted, nil
+}
+
+// 块内文档数在 [1, postingBlockSize] 中，deltas 和权重都在段数据中
+func validBlockHeader(header []byte, size uint64) bool {
+	length := uint64(binary.LittleEndian.Uint32(header[8:]))
+	deltasLength := uint64(binary.LittleEndian.Uint32(header[16:]))
+	deltas := binary.LittleEndian.Uint64(header[20:])
+	return length >= 1 && length <= postingBlockSize &&
+		deltas <= size && deltasLength+2*length <= size-deltas
+}
+
+// 把段写入 folder 中的临时文件并映射到内存，文件映射后即被删除
+// 调用者持有映射的一个引用，加入快照后应释放
+func mapSegment(seg *segment, folder string) (*segment, error) {
+	file, err := os.CreateTemp(folder, "segment.*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	writer := &indexWriter{w: bufio.NewWriter(file)}
+	writeSegment(writer, seg, nil)
+	if writer.err == nil {
+		writer.err = writer.w.Flush()
+	}
+	if writer.err != nil {
+		return nil, writer.err
+	}
+	mapping, err := mapFile(file)
+	if err != nil {
+		return nil, err
+	}
+	mapped, _, err := parseSegment(mapping, mapping.data[8:])
+	if err != nil {
+		mapping.release()
+	}
+	return mapped, err
+}
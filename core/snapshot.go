@@ -0,0 +1,110 @@
+package core
+
+import (
+	"sync/atomic"
+)
+
+// 反向索引在某一时刻的只读视图
+// 快照生成后不再修改，查找时不需要加锁，写入时复制出新快照后原子替换
+type indexSnapshot struct {
+	segments []*segment
+
+	// 各段中已删除或被新版本替换的文档，和 segments 一一对应
+	// 和快照一样不可修改，需要改变时用 Bitmap.With 生成新的位图
+	deleted []*Bitmap
+
+	// 索引器的当前快照持有一个引用，每个使用中的查找各持有一个引用
+	// 引用数降为 0 后不能再取得，快照中的段用到的索引文件映射各释放一个引用
+	references int32
+}
+
+// 复制快照的段列表，段和删除表本身是共享的
+func (snap *indexSnapshot) clone() *indexSnapshot {
+	return &indexSnapshot{
+		segments: append([]*segment(nil), snap.segments...),
+		deleted:  append([]*Bitmap(nil), snap.deleted...),
+	}
+}
+
+// 在包含这些文档的段中把文档标记为删除，只用于尚未发布的新快照
+// 删除位图只复制被修改的容器，删除的代价和段的大小无关
+func (snap *indexSnapshot) deleteDocuments(docIds []uint32) {
+	for i, seg := range snap.segments {
+		var contained []uint32
+		for _, docId := range docIds {
+			if seg.contains(docId) {
+				contained = append(contained, docId)
+			}
+		}
+		if len(contained) > 0 {
+			snap.deleted[i] = snap.deleted[i].With(contained...)
+		}
+	}
+}
+
+// 快照中的段用到的索引文件映射，每个只出现一次
+func (snap *indexSnapshot) mappings() (mappings []*fileMapping) {
+	for _, seg := range snap.segments {
+		if seg.file == nil {
+			continue
+		}
+		found := false
+		for _, mapping := range mappings {
+			found = found || mapping == seg.file.mapping
+		}
+		if !found {
+			mappings = append(mappings, seg.file.mapping)
+		}
+	}
+	return
+}
+
+// 增加一个引用，快照已被释放时返回 false
+func (snap *indexSnapshot) acquire() bool {
+	for {
+		references := atomic.LoadInt32(&snap.references)
+		if references == 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&snap.references, references, references+1) {
+			return true
+		}
+	}
+}
+
+func (snap *indexSnapshot) release() {
+	if atomic.AddInt32(&snap.references, -1) == 0 {
+		for _, mapping := range snap.mappings() {
+			mapping.release()
+		}
+	}
+}
+
+// 得到当前快照并持有一个引用，用完后需调用 release，此函数线程安全
+// 持有引用期间快照中映射的索引文件不会被解除映射，倒排块可以安全读取
+func (indexer *Indexer) snapshot() *indexSnapshot {
+	for {
+		// 取得引用前快照可能已被替换并释放，这时重新读取
+		if snap := indexer.current.Load().(*indexSnapshot); snap.acquire() {
+			return snap
+		}
+	}
+}
+
+// 得到当前快照，不持有引用，调用者需持有 tableLock 以保证快照不被替换
+func (indexer *Indexer) currentSnapshot() *indexSnapshot {
+	return indexer.current.Load().(*indexSnapshot)
+}
+
+// 把 snap 发布为当前快照并释放原来的当前快照，调用者需持有 tableLock
+func (indexer *Indexer) publish(snap *indexSnapshot) {
+	snap.references = 1
+	for _, mapping := range snap.mappings() {
+		mapping.acquire()
+	}
+	old, _ := indexer.current.Load().(*indexSnapshot)
+	indexer.current.Store(snap)
+	if old != nil {
+		old.release()
+	}
+}
@@ -0,0 +1,245 @@
+package core
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// 内存估计用到的开销，按 64 位平台计算
+const (
+	// map 中每一项的平均开销，包括键值和空闲槽位，引擎估计其中的映射时也使用
+	MapEntryBytes = 48
+
+	// 内存中的段每个关键词除关键词本身和倒排块以外的开销：table 中的项、keywords 中的字符串头和 KeywordIndices
+	keywordEntryBytes = MapEntryBytes + 16 + 40
+
+	// 解码后的 postingBlock 结构，不包括块内数据
+	blockStructBytes = 72
+)
+
+// 索引器的统计信息，用于查看索引规模和内存占用
+type IndexerStats struct {
+	// 未删除的文档数，不包括 ADDCACHE 中的文档
+	NumDocuments uint32
+
+	// ADDCACHE 中尚未加入索引的文档数
+	NumCachedDocuments uint32
+
+	// 已删除但尚未在合并中清理的文档数
+	NumDeletedDocuments int
+
+	// 段数，其中 NumMappedSegments 个保存在映射到内存的索引文件中
+	NumSegments       int
+	NumMappedSegments int
+
+	// 不同的关键词数，同一关键词出现在多个段中只计一次，不包括内部索引项
+	NumKeywords int
+
+	// 不同的内部索引项数，见 IndexerInitOptions.InternalKeywordPrefixes
+	NumInternalKeywords int
+
+	// 全部倒排表的总长度，包括尚未清理的已删除文档
+	NumPostings int
+
+	// 全部倒排表压缩后的字节数，包括映射文件中的倒排表
+	PostingBytes int64
+
+	// 映射到内存的段数据字节数，由操作系统按需换入，不占用 Go 堆
+	MappedBytes int64
+
+	// 占用 Go 堆的估计值，包括内存中的段、删除表、文档长度和数值字段
+	MemoryBytes int64
+}
+
+// 一个关键词在索引器中的倒排表统计
+type KeywordStats struct {
+	Word string
+
+	// 包含关键词的未删除文档数
+	DocumentFrequency int
+
+	// 倒排表总长度，包括尚未清理的已删除文档
+	PostingLength int
+
+	// 出现该关键词的段数和这些段中的压缩块数
+	NumSegments int
+	NumBlocks   int
+
+	// 倒排表压缩后的字节数，和写入索引文件时相同
+	Bytes int64
+}
+
+// 一个段中某个关键词的倒排表
+type keywordPostings struct {
+	// 段在快照中的位置
+	segment int
+	indices *KeywordIndices
+}
+
+// 按字典序依次访问快照中的全部关键词，同一关键词在各段中的倒排表一起传给 fn
+// 各段的关键词已经排序，逐个归并，不需要把整个词典复制到内存中
+func (snap *indexSnapshot) forEachKeyword(fn func(word string, postings []keywordPostings)) {
+	positions := make([]int, len(snap.segments))
+	words := make([]string, len(snap.segments))
+	for i, seg := range snap.segments {
+		if seg.numKeywords() > 0 {
+			words[i] = seg.keywordAt(0)
+		}
+	}
+	var postings []keywordPostings
+	for {
+		word, found := "", false
+		for i, seg := range snap.segments {
+			if positions[i] < seg.numKeywords() && (!found || words[i] < word) {
+				word, found = words[i], true
+			}
+		}
+		if !found {
+			return
+		}
+		postings = postings[:0]
+		for i, seg := range snap.segments {
+			if positions[i] < seg.numKeywords() && words[i] == word {
+				postings = append(postings, keywordPostings{segment: i, indices: seg.indicesAt(positions[i])})
+				if positions[i]++; positions[i] < seg.numKeywords() {
+					words[i] = seg.keywordAt(positions[i])
+				}
+			}
+		}
+		fn(word, postings)
+	}
+}
+
+// 倒排表压缩后的字节数
+func postingBytes(indices *KeywordIndices) (bytes int64) {
+	for _, block := range indices.blocks {
+		bytes += blockHeaderSize + int64(len(block.deltas)+len(block.weights))
+	}
+	return
+}
+
+func keywordStats(snap *indexSnapshot, word string, postings []keywordPostings) KeywordStats {
+	stats := KeywordStats{Word: word, NumSegments: len(postings)}
+	for _, p := range postings {
+		stats.DocumentFrequency += snap.segments[p.segment].frequency(p.indices, snap.deleted[p.segment])
+		stats.PostingLength += p.indices.length
+		stats.NumBlocks += len(p.indices.blocks)
+		stats.Bytes += postingBytes(p.indices)
+	}
+	return stats
+}
+
+// 得到索引器的统计信息，需要遍历全部关键词，此函数线程安全
+func (indexer *Indexer) Stats() (stats IndexerStats) {
+	snap := indexer.snapshot()
+	defer snap.release()
+	stats.NumSegments = len(snap.segments)
+	for i, seg := range snap.segments {
+		stats.NumDeletedDocuments += snap.deleted[i].Cardinality()
+		stats.MemoryBytes += 4*int64(len(seg.docIds)) + snap.deleted[i].sizeInBytes()
+		if seg.file != nil {
+			stats.NumMappedSegments++
+			stats.MappedBytes += int64(len(seg.file.data))
+		}
+	}
+	snap.forEachKeyword(func(word string, postings []keywordPostings) {
+		if indexer.isInternalKeyword(word) {
+			stats.NumInternalKeywords++
+		} else {
+			stats.NumKeywords++
+		}
+		for _, p := range postings {
+			bytes := postingBytes(p.indices)
+			stats.NumPostings += p.indices.length
+			stats.PostingBytes += bytes
+			if snap.segments[p.segment].file == nil {
+				// 内存中的块没有文件中的块头，换成解码后的结构
+				numBlocks := int64(len(p.indices.blocks))
+				stats.MemoryBytes += keywordEntryBytes + int64(len(word)) + bytes +
+					numBlocks*(blockStructBytes-blockHeaderSize)
+			}
+		}
+	})
+
+	indexer.addCacheLock.RLock()
+	stats.NumCachedDocuments = indexer.addCacheLock.addCachePointer
+	indexer.addCacheLock.RUnlock()
+
+	stats.NumDocuments = indexer.NumDocuments()
+	indexer.tableLock.Lock()
+	stats.MemoryBytes += MapEntryBytes * int64(len(indexer.docTokenLengths))
+	indexer.tableLock.Unlock()
+
+	indexer.docValues.RLock()
+	numOrdinals := int64(len(indexer.docValues.docIds))
+	stats.MemoryBytes += MapEntryBytes*int64(len(indexer.docValues.ordinals)) +
+		4*(numOrdinals+int64(len(indexer.docValues.free))) +
+		8*numOrdinals*int64(len(indexer.docValues.names))
+	for _, present := range indexer.docValues.present {
+		stats.MemoryBytes += present.sizeInBytes()
+	}
+	indexer.docValues.RUnlock()
+	return
+}
+
+// 得到关键词的倒排表统计，关键词不在索引中时各项为 0，此函数线程安全
+func (indexer *Indexer) KeywordStats(word string) KeywordStats {
+	snap := indexer.snapshot()
+	defer snap.release()
+	var postings []keywordPostings
+	for i, seg := range snap.segments {
+		if indices, found := seg.lookup(word); found {
+			postings = append(postings, keywordPostings{segment: i, indices: indices})
+		}
+	}
+	return keywordStats(snap, word, postings)
+}
+
+// 按未删除的文档数从大到小返回前 k 个关键词，文档数相同时按字典序排列，不包括内部索引项
+// 需要遍历全部关键词，此函数线程安全
+func (indexer *Indexer) TopKeywords(k int) []KeywordFrequency {
+	if k <= 0 {
+		return nil
+	}
+	snap := indexer.snapshot()
+	defer snap.release()
+	top := &keywordHeap{}
+	snap.forEachKeyword(func(word string, postings []keywordPostings) {
+		if indexer.isInternalKeyword(word) {
+			return
+		}
+		keyword := KeywordFrequency{Word: word, Frequency: keywordStats(snap, word, postings).DocumentFrequency}
+		if keyword.Frequency == 0 {
+			return
+		}
+		if top.Len() < k {
+			heap.Push(top, keyword)
+		} else if keywordBefore(keyword, (*top)[0]) {
+			(*top)[0] = keyword
+			heap.Fix(top, 0)
+		}
+	})
+	SortKeywordsByFrequency(*top)
+	return *top
+}
+
+// 把关键词按文档数从大到小排列，文档数相同时按字典序排列
+func SortKeywordsByFrequency(keywords []KeywordFrequency) {
+	sort.Slice(keywords, func(i, j int) bool { return keywordBefore(keywords[i], keywords[j]) })
+}
+
+func keywordBefore(a, b KeywordFrequency) bool {
+	return a.Frequency > b.Frequency || (a.Frequency == b.Frequency && a.Word < b.Word)
+}
+
+// 排在最后的关键词在堆顶，保存当前排在前面的 k 个关键词
+type keywordHeap []KeywordFrequency
+
+func (h keywordHeap) Len() int            { return len(h) }
+func (h keywordHeap) Less(i, j int) bool  { return keywordBefore(h[j], h[i]) }
+func (h keywordHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *keywordHeap) Push(x interface{}) { *h = append(*h, x.(KeywordFrequency)) }
+func (h *keywordHeap) Pop() (x interface{}) {
+	x, *h = (*h)[len(*h)-1], (*h)[:len(*h)-1]
+	return
+}
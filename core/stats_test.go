@@ -0,0 +1,44 @@
+package core
+
+import (
+	"github.com/huichen/wukong/utils"
+	"octopus/types"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	var indexer Indexer
+	indexer.Init(IndexerInitOptions{})
+	addDocument := func(docId uint32, forceUpdate bool, words ...string) {
+		document := &types.DocumentIndex{DocId: docId}
+		for _, word := range words {
+			document.Keywords = append(document.Keywords, types.Keyword{Word: word, Weight: 1})
+		}
+		indexer.AddDocumentToCache(document, forceUpdate)
+	}
+	addDocument(1, false, "恋爱", "婚姻")
+	addDocument(2, false, "恋爱", "分手")
+	addDocument(3, true, "恋爱", "婚姻")
+	addDocument(4, true, "婚姻")
+	addDocument(5, false, "恋爱")
+	indexer.RemoveDocument(2)
+
+	stats := indexer.Stats()
+	utils.Expect(t, "3", stats.NumDocuments)
+	utils.Expect(t, "1", stats.NumCachedDocuments)
+	utils.Expect(t, "1", stats.NumDeletedDocuments)
+	utils.Expect(t, "2", stats.NumSegments)
+	utils.Expect(t, "3", stats.NumKeywords)
+	utils.Expect(t, "7", stats.NumPostings)
+	utils.Expect(t, "true", stats.MemoryBytes > stats.PostingBytes)
+
+	keyword := indexer.KeywordStats("婚姻")
+	utils.Expect(t, "[3 3 2 2]", []int{keyword.DocumentFrequency, keyword.PostingLength, keyword.NumSegments, keyword.NumBlocks})
+	// 已删除的文档仍在倒排表中，直到合并时清理
+	keyword = indexer.KeywordStats("恋爱")
+	utils.Expect(t, "[2 3]", []int{keyword.DocumentFrequency, keyword.PostingLength})
+	utils.Expect(t, "0", indexer.KeywordStats("离婚").PostingLength)
+
+	utils.Expect(t, "[{婚姻 3} {恋爱 2}]", indexer.TopKeywords(2))
+	utils.Expect(t, "[{婚姻 3} {恋爱 2}]", indexer.TopKeywords(5))
+}
@@ -0,0 +1,340 @@
+package core
+
+import (
+	"container/heap"
+	"log"
+	"math"
+	"octopus/types"
+	"sort"
+)
+
+// 倒排表遍历结束时游标的 DocId
+const endOfPostings = math.MaxUint32
+
+// 倒排表上的游标，只能向前移动
+// 压缩块的首尾 DocId 作为跳表指针，跳过的块不需要解码
+type postingCursor struct {
+	indices *KeywordIndices
+
+	// 检索词的系数，得分为 权重*系数
+	coefficient float32
+
+	// 当前块，以及已解码的块和解码结果
+	block        int
+	decodedBlock int
+	docIds       []uint32
+	weights      []float32
+
+	// 当前文档在解码结果中的位置和 DocId
+	position int
+	docId    uint32
+}
+
+func newPostingCursor(indices *KeywordIndices, coefficient float32) *postingCursor {
+	cursor := &postingCursor{indices: indices, coefficient: coefficient, decodedBlock: -1}
+	cursor.seek(0)
+	return cursor
+}
+
+// 把块指针移动到第一个可能包含 target 的块，即最后一个 DocId 不小于 target 的块，不解码
+// 没有这样的块时返回 false
+func (cursor *postingCursor) shallowAdvance(target uint32) bool {
+	blocks := cursor.indices.blocks
+	cursor.block += sort.Search(len(blocks)-cursor.block, func(i int) bool {
+		return blocks[cursor.block+i].lastDocId >= target
+	})
+	return cursor.block < len(blocks)
+}
+
+// 移动到第一个 DocId 不小于 target 的文档
+func (cursor *postingCursor) advance(target uint32) {
+	if cursor.docId >= target {
+		return
+	}
+	cursor.seek(target)
+}
+
+func (cursor *postingCursor) seek(target uint32) {
+	if !cursor.shallowAdvance(target) {
+		cursor.docId = endOfPostings
+		return
+	}
+	if cursor.decodedBlock != cursor.block {
+		cursor.docIds, cursor.weights = cursor.indices.blocks[cursor.block].decode(
+			cursor.docIds[:0], cursor.weights[:0])
+		cursor.decodedBlock = cursor.block
+		cursor.position = 0
+	}
+	// 块的最后一个 DocId 不小于 target，一定能找到
+	cursor.position += sort.Search(len(cursor.docIds)-cursor.position, func(i int) bool {
+		return cursor.docIds[cursor.position+i] >= target
+	})
+	cursor.docId = cursor.docIds[cursor.position]
+}
+
+// 当前文档的得分
+func (cursor *postingCursor) score() float32 {
+	return cursor.weights[cursor.position] * cursor.coefficient
+}
+
+// 文档 target 在此倒排表中得分的上界，即可能包含它的块的最大权重*系数
+func (cursor *postingCursor) upperBound(target uint32) float32 {
+	if !cursor.shallowAdvance(target) {
+		return 0
+	}
+	block := &cursor.indices.blocks[cursor.block]
+	if block.firstDocId > target {
+		return 0
+	}
+	return block.maxWeight * cursor.coefficient
+}
+
+// upperBound(target) 对 [target, 返回值) 中的文档都有效
+func (cursor *postingCursor) boundEnd(target uint32) uint32 {
+	if !cursor.shallowAdvance(target) {
+		return endOfPostings
+	}
+	block := &cursor.indices.blocks[cursor.block]
+	if block.firstDocId > target {
+		return block.firstDocId
+	}
+	return block.lastDocId + 1
+}
+
+// 一个检索词组中全部检索词的游标，组内为 OR 关系
+type groupCursor []*postingCursor
+
+// 组内各游标中最小的 DocId
+func (group groupCursor) docId() uint32 {
+	docId := uint32(endOfPostings)
+	for _, cursor := range group {
+		if cursor.docId < docId {
+			docId = cursor.docId
+		}
+	}
+	return docId
+}
+
+func (group groupCursor) advance(target uint32) {
+	for _, cursor := range group {
+		cursor.advance(target)
+	}
+}
+
+// 文档在组内的得分，取位于该文档的游标中的最大得分
+func (group groupCursor) score(docId uint32) (score float32) {
+	for _, cursor := range group {
+		if cursor.docId == docId && cursor.score() > score {
+			score = cursor.score()
+		}
+	}
+	return
+}
+
+func (group groupCursor) upperBound(target uint32) (bound float32) {
+	for _, cursor := range group {
+		if b := cursor.upperBound(target); b > bound {
+			bound = b
+		}
+	}
+	return
+}
+
+func (group groupCursor) boundEnd(target uint32) uint32 {
+	end := uint32(endOfPostings)
+	for _, cursor := range group {
+		if e := cursor.boundEnd(target); e < end {
+			end = e
+		}
+	}
+	return end
+}
+
+// 得分最低的文档在堆顶的小顶堆，保存当前得分最高的 k 个文档
+type topKHeap struct {
+	k     int
+	pairs PairList
+}
+
+func (h *topKHeap) Len() int           { return len(h.pairs) }
+func (h *topKHeap) Less(i, j int) bool { return h.pairs[i].Value < h.pairs[j].Value }
+func (h *topKHeap) Swap(i, j int)      { h.pairs[i], h.pairs[j] = h.pairs[j], h.pairs[i] }
+func (h *topKHeap) Push(x interface{}) { h.pairs = append(h.pairs, x.(Pair)) }
+func (h *topKHeap) Pop() (x interface{}) {
+	x, h.pairs = h.pairs[len(h.pairs)-1], h.pairs[:len(h.pairs)-1]
+	return
+}
+
+func (h *topKHeap) full() bool {
+	return len(h.pairs) >= h.k
+}
+
+// 进入前 k 名需要超过的得分
+func (h *topKHeap) threshold() float32 {
+	return h.pairs[0].Value
+}
+
+func (h *topKHeap) add(docId uint32, score float32) {
+	if !h.full() {
+		heap.Push(h, Pair{docId, score})
+	} else if score > h.threshold() {
+		h.pairs[0] = Pair{docId, score}
+		heap.Fix(h, 0)
+	}
+}
+
+// 用 Block-Max WAND 在段内查找满足全部检索词组的文档，加入 results
+// 组间为 AND 关系，因此 pivot 取各组当前 DocId 的最大值
+// 堆满后先用各组块最大得分之和估计 pivot 的得分上界，不超过门限时跳过上界有效的整个区间
+func (seg *segment) topK(groups [][]types.QueryToken, deleted, filter *Bitmap, results *topKHeap) {
+	cursors := seg.groupCursors(groups)
+	if cursors == nil {
+		return
+	}
+
+	for {
+		var pivot uint32
+		for _, cursor := range cursors {
+			if docId := cursor.docId(); docId > pivot {
+				pivot = docId
+			}
+		}
+		if pivot == endOfPostings {
+			return
+		}
+
+		if results.full() {
+			var bound float32
+			for _, cursor := range cursors {
+				bound += cursor.upperBound(pivot)
+			}
+			if bound <= results.threshold() {
+				next := uint32(endOfPostings)
+				for _, cursor := range cursors {
+					if end := cursor.boundEnd(pivot); end < next {
+						next = end
+					}
+				}
+				if next <= pivot {
+					next = pivot + 1
+				}
+				for _, cursor := range cursors {
+					cursor.advance(next)
+				}
+				continue
+			}
+		}
+
+		matched := true
+		for _, cursor := range cursors {
+			cursor.advance(pivot)
+			if cursor.docId() != pivot {
+				matched = false
+			}
+		}
+		if !matched {
+			continue
+		}
+		if !deleted.Contains(pivot) && (filter == nil || filter.Contains(pivot)) {
+			var score float32
+			for _, cursor := range cursors {
+				score += cursor.score(pivot)
+			}
+			results.add(pivot, score)
+		}
+		for _, cursor := range cursors {
+			cursor.advance(pivot + 1)
+		}
+	}
+}
+
+// 各检索词组在段内的游标，段内没有某一组的任何检索词时返回 nil
+func (seg *segment) groupCursors(groups [][]types.QueryToken) []groupCursor {
+	cursors := make([]groupCursor, 0, len(groups))
+	for _, group := range groups {
+		var cursor groupCursor
+		for _, token := range group {
+			if indices, found := seg.lookup(token.Word); found {
+				cursor = append(cursor, newPostingCursor(indices, token.Weight))
+			}
+		}
+		if len(cursor) == 0 {
+			return nil
+		}
+		cursors = append(cursors, cursor)
+	}
+	return cursors
+}
+
+// 段内满足全部检索词组的未删除文档数，只按 DocId 求交集，不计算得分
+func (seg *segment) count(groups [][]types.QueryToken, deleted, filter *Bitmap) (count int) {
+	cursors := seg.groupCursors(groups)
+	if cursors == nil {
+		return
+	}
+	for {
+		var pivot uint32
+		for _, cursor := range cursors {
+			if docId := cursor.docId(); docId > pivot {
+				pivot = docId
+			}
+		}
+		if pivot == endOfPostings {
+			return
+		}
+		matched := true
+		for _, cursor := range cursors {
+			cursor.advance(pivot)
+			if cursor.docId() != pivot {
+				matched = false
+			}
+		}
+		if !matched {
+			continue
+		}
+		if !deleted.Contains(pivot) && (filter == nil || filter.Contains(pivot)) {
+			count++
+		}
+		for _, cursor := range cursors {
+			cursor.advance(pivot + 1)
+		}
+	}
+}
+
+// 满足全部检索词组的文档数，和 LookupGroups 返回的文档数相同，但不计算得分，此函数线程安全
+func (indexer *Indexer) CountGroups(groups [][]types.QueryToken, filter *Bitmap) (count int) {
+	if indexer.initialized == false {
+		log.Fatal("索引器尚未初始化")
+	}
+	snap := indexer.snapshot()
+	defer snap.release()
+	if len(groups) == 0 {
+		return
+	}
+	for i, seg := range snap.segments {
+		count += seg.count(groups, snap.deleted[i], filter)
+	}
+	return
+}
+
+// 查找满足全部检索词组且得分最高的 k 个文档，按得分从大到小排列
+// 得分的计算和 filter 的含义和 LookupGroups 相同，但不会遍历不可能进入前 k 名的文档
+func (indexer *Indexer) LookupTopK(groups [][]types.QueryToken, k int, filter *Bitmap) (docs PairList) {
+	if indexer.initialized == false {
+		log.Fatal("索引器尚未初始化")
+	}
+
+	snap := indexer.snapshot()
+	defer snap.release()
+	if len(snap.segments) == 0 || len(groups) == 0 || k <= 0 {
+		return
+	}
+
+	results := &topKHeap{k: k}
+	for i, seg := range snap.segments {
+		seg.topK(groups, snap.deleted[i], filter, results)
+	}
+	docs = results.pairs
+	sort.Sort(docs)
+	return
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"fmt"
+	"github.com/huichen/wukong/utils"
+	"math/rand"
+	"octopus/types"
+	"testing"
+)
+
+func TestLookupTopK(t *testing.T) {
+	var indexer Indexer
+	// 后台合并和两次查找同时进行，合并不改变文档的得分
+	indexer.Init(IndexerInitOptions{DocCacheSize: 300})
+	random := rand.New(rand.NewSource(1))
+	words := []string{"男朋友", "男友", "恋爱", "结婚"}
+	for i := 0; i < 3000; i++ {
+		// 后 1000 个文档替换前面的旧版本
+		docId := uint32(i%2000 + 1)
+		var keywords []types.Keyword
+		for _, word := range words {
+			if random.Intn(3) > 0 {
+				keywords = append(keywords, types.Keyword{Word: word, Weight: random.Float32()})
+			}
+		}
+		indexer.AddDocumentToCache(&types.DocumentIndex{DocId: docId, Keywords: keywords}, i == 2999)
+	}
+
+	groups := [][]types.QueryToken{
+		{{Word: "男朋友", Weight: 1}, {Word: "男友", Weight: 0.5}},
+		{{Word: "恋爱", Weight: 1}},
+	}
+	all := indexer.LookupGroups(groups, nil)
+	docs := indexer.LookupTopK(groups, 20, nil)
+	utils.Expect(t, "20", len(docs))
+	for i := range docs {
+		utils.Expect(t, fmt.Sprint(all[i].Value), docs[i].Value)
+	}
+	utils.Expect(t, fmt.Sprint(len(all)), len(indexer.LookupTopK(groups, len(all)+1, nil)))
+	utils.Expect(t, fmt.Sprint(len(all)), indexer.CountGroups(groups, nil))
+	filter := BitmapOf(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+	utils.Expect(t, fmt.Sprint(len(indexer.LookupGroups(groups, filter))), indexer.CountGroups(groups, filter))
+}
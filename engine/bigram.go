@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"octopus/core"
+	"octopus/types"
+	"unicode"
+)
+
+// 二元组索引项的前缀
+const bigramKeywordPrefix = "bg:"
+
+// 把文本切分为由字母、数字和汉字组成的连续片段，返回片段中每两个相邻字符组成的二元组
+// 例如 "乔一的F君" 得到 "乔一"、"一的"、"的f"、"f君"（已归一化为小写时）
+func bigrams(text string) []string {
+	var grams []string
+	var previous rune
+	for _, r := range text {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			previous = 0
+			continue
+		}
+		if previous != 0 {
+			grams = append(grams, string([]rune{previous, r}))
+		}
+		previous = r
+	}
+	return grams
+}
+
+// 为正文中的全部二元组加入索引项，权重为出现次数除以最大出现次数
+func addBigramKeywords(tokensMap map[string]float32, content string) {
+	counts := make(map[string]float32)
+	var maxCount float32
+	for _, gram := range bigrams(content) {
+		counts[gram]++
+		if counts[gram] > maxCount {
+			maxCount = counts[gram]
+		}
+	}
+	for gram, count := range counts {
+		tokensMap[bigramKeywordPrefix+gram] = count / maxCount
+	}
+}
+
+// 用二元组索引查找包含查询文本中全部二元组的文档，追加到 docs 中没有的文档之后
+// 二元组命中的得分乘以 BigramWeight，且总是排在词语级别命中的文档之后
+func (engine *Engine) appendBigramResults(text string, docs core.PairList, filters []*core.Bitmap) core.PairList {
+	grams := bigrams(text)
+	if len(grams) == 0 {
+		return docs
+	}
+	groups := make([][]types.QueryToken, len(grams))
+	for i, gram := range grams {
+		groups[i] = []types.QueryToken{{
+			Word: bigramKeywordPrefix + gram, Weight: engine.initOptions.BigramWeight}}
+	}
+
+	found := make(map[uint32]bool, len(docs))
+	for _, doc := range docs {
+		found[doc.Key] = true
+	}
+	var bigramDocs core.PairList
+	for _, doc := range engine.lookup(groups, filters) {
+		if !found[doc.Key] {
+			bigramDocs = append(bigramDocs, doc)
+		}
+	}
+	return append(docs, bigramDocs...)
+}
@@ -0,0 +1,31 @@
+package engine
+
+import (
+	"github.com/huichen/wukong/utils"
+	"testing"
+)
+
+func TestBigrams(t *testing.T) {
+	cases := []struct {
+		text, grams string
+	}{
+		// 汉字和拉丁字母、数字相邻时也组成二元组
+		{"乔一的F君", "[乔一 一的 的F F君]"},
+		{"iPhone15发布", "[iP Ph ho on ne e1 15 5发 发布]"},
+		// 标点、空白和表情符号把文本分为不相连的片段
+		{"恋爱，婚姻 分手", "[恋爱 婚姻 分手]"},
+		{"恋爱😀婚姻", "[恋爱 婚姻]"},
+		{"a b 恋", "[]"},
+		{"", "[]"},
+	}
+	for _, c := range cases {
+		utils.Expect(t, c.grams, bigrams(c.text))
+	}
+}
+
+func TestAddBigramKeywords(t *testing.T) {
+	// 权重为出现次数除以最大出现次数，原有的关键词不变
+	tokensMap := map[string]float32{"恋爱": 0.7}
+	addBigramKeywords(tokensMap, "恋爱恋爱，分手")
+	utils.Expect(t, "map[bg:分手:0.5 bg:恋爱:1 bg:爱恋:0.5 恋爱:0.7]", tokensMap)
+}
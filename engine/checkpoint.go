@@ -0,0 +1,317 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"octopus/storage"
+	"octopus/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 检查点在持久存储目录中的文件：
+//
+//	index.manifest            最近一次完成的检查点，最后写入
+//	index.<检查点>.<shard>     各索引器 shard 的索引，见 core.Indexer.Save
+//	docids.<检查点>            索引中的文档序号对应的 DocId，见 doc_ordinals.go
+//	zuiyou.journal.<检查点>.<shard>  该检查点开始之后写入或删除的文档，key 和持久存储相同
+const (
+	indexManifestFile    = "index.manifest"
+	indexFilePrefix      = "index"
+	docIdsFilePrefix     = "docids"
+	journalFilePrefix    = PersistentStorageFilePrefix + ".journal"
+	indexManifestVersion = 3
+)
+
+type indexManifest struct {
+	Version    int
+	Checkpoint uint64
+	NumShards  uint32
+	Settings   indexSettings
+}
+
+// 决定文档生成哪些关键词的选项，和检查点中保存的不同时索引中的关键词对不上，需要重建
+type indexSettings struct {
+	ContentFormat     int
+	SkipCodeBlocks    bool
+	ExtractEntities   bool
+	KeywordExtraction int
+	KeywordTopK       int
+	Normalization     NormalizationOptions
+	StemEnglishWords  bool
+	UsePinyinIndex    bool
+	UseBigramIndex    bool
+}
+
+func (engine *Engine) indexSettings() indexSettings {
+	options := &engine.initOptions
+	return indexSettings{
+		ContentFormat:     options.ContentFormat,
+		SkipCodeBlocks:    options.SkipCodeBlocks,
+		ExtractEntities:   options.ExtractEntities,
+		KeywordExtraction: options.KeywordExtraction,
+		KeywordTopK:       options.KeywordTopK,
+		Normalization:     options.Normalization,
+		StemEnglishWords:  options.StemEnglishWords,
+		UsePinyinIndex:    options.UsePinyinIndex,
+		UseBigramIndex:    options.UseBigramIndex,
+	}
+}
+
+func (engine *Engine) storagePath(name string) string {
+	return engine.initOptions.PersistentStorageFolder + "/" + name
+}
+
+func (engine *Engine) checkpointFilePath(prefix string, checkpoint uint64, shard int) string {
+	return engine.storagePath(fmt.Sprintf("%s.%d.%d", prefix, checkpoint, shard))
+}
+
+// 从 prefix.<检查点>.<shard> 或 prefix.<检查点> 形式的文件名中得到检查点编号
+func checkpointOfFile(path, prefix string) (uint64, bool) {
+	name := filepath.Base(path)
+	if !strings.HasPrefix(name, prefix+".") {
+		return 0, false
+	}
+	parts := strings.Split(strings.TrimPrefix(name, prefix+"."), ".")
+	if len(parts) > 2 {
+		return 0, false
+	}
+	checkpoint, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	if len(parts) == 2 {
+		if _, err := strconv.Atoi(parts[1]); err != nil {
+			return 0, false
+		}
+	}
+	return checkpoint, true
+}
+
+// 持久存储目录中 prefix.<检查点>.<shard> 形式的文件对应的检查点编号，从小到大排列
+func (engine *Engine) checkpointsOfFiles(prefix string) (checkpoints []uint64) {
+	paths, _ := filepath.Glob(engine.storagePath(prefix + ".*"))
+	found := make(map[uint64]bool)
+	for _, path := range paths {
+		if checkpoint, ok := checkpointOfFile(path, prefix); ok && !found[checkpoint] {
+			found[checkpoint] = true
+			checkpoints = append(checkpoints, checkpoint)
+		}
+	}
+	sort.Slice(checkpoints, func(i, j int) bool { return checkpoints[i] < checkpoints[j] })
+	return
+}
+
+// 删除持久存储目录中检查点编号小于 checkpoint 的 prefix 文件
+func (engine *Engine) removeCheckpointFiles(prefix string, checkpoint uint64) {
+	paths, _ := filepath.Glob(engine.storagePath(prefix + ".*"))
+	for _, path := range paths {
+		if c, ok := checkpointOfFile(path, prefix); ok && c < checkpoint {
+			os.Remove(path)
+		}
+	}
+}
+
+// 读入最近一次检查点的索引，成功时返回检查点编号
+// 没有检查点或检查点和当前配置不符时返回 false，需要从持久存储重建全部索引
+func (engine *Engine) loadCheckpoint() (uint64, bool) {
+	file, err := os.Open(engine.storagePath(indexManifestFile))
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+	var manifest indexManifest
+	if err := gob.NewDecoder(file).Decode(&manifest); err != nil ||
+		manifest.Version != indexManifestVersion || manifest.NumShards != engine.initOptions.NumShards ||
+		manifest.Settings != engine.indexSettings() {
+		fmt.Println("检查点和当前配置不符，从持久存储重建索引")
+		return 0, false
+	}
+
+	// 先读入 DocId 映射，之后读入的索引中的文档序号都依赖它
+	path := engine.storagePath(fmt.Sprintf("%s.%d", docIdsFilePrefix, manifest.Checkpoint))
+	docIds, err := readDocIds(path)
+	if err != nil {
+		fmt.Println("无法读取 DocId 映射文件", path, ":", err, "，从持久存储重建索引")
+		return 0, false
+	}
+	engine.initDocOrdinals(docIds)
+
+	for shard := range engine.indexers {
+		path := engine.checkpointFilePath(indexFilePrefix, manifest.Checkpoint, shard)
+		if err := engine.indexers[shard].LoadFile(path); err != nil {
+			fmt.Println("无法读取索引文件", path, ":", err, "，从持久存储重建索引")
+			// 已读入的 shard 中可能有已从持久存储删除的文档，全部清空后重建
+			for i := range engine.indexers[:shard] {
+				engine.indexers[i].Reset()
+			}
+			engine.initDocOrdinals([]uint64{0})
+			return 0, false
+		}
+	}
+	fmt.Println("从检查点", manifest.Checkpoint, "读入索引")
+	return manifest.Checkpoint, true
+}
+
+// 打开检查点 checkpoint 的各持久存储 shard 的日志
+func (engine *Engine) openJournals(checkpoint uint64) ([]storage.Storage, error) {
+	journals := make([]storage.Storage, engine.initOptions.PersistentStorageShards)
+	for shard := range journals {
+		journal, err := storage.OpenStorage(engine.checkpointFilePath(journalFilePrefix, checkpoint, shard))
+		if err != nil {
+			for _, j := range journals[:shard] {
+				j.Close()
+			}
+			return nil, err
+		}
+		journals[shard] = journal
+	}
+	return journals, nil
+}
+
+// 启动时打开当前的日志，之后写入持久存储的文档都记录在其中
+// 不再需要的旧日志被删除
+func (engine *Engine) initJournals(checkpoint uint64) {
+	engine.removeCheckpointFiles(journalFilePrefix, checkpoint)
+	current := checkpoint
+	if checkpoints := engine.checkpointsOfFiles(journalFilePrefix); len(checkpoints) > 0 &&
+		checkpoints[len(checkpoints)-1] > current {
+		current = checkpoints[len(checkpoints)-1]
+	}
+	journals, err := engine.openJournals(current)
+	if err != nil {
+		log.Fatal("无法打开日志", err)
+	}
+	engine.journalLock.checkpoint = current
+	engine.journalLock.journals = journals
+}
+
+// 在当前日志中记录写入持久存储的文档，keys 在一个事务中写入
+func (engine *Engine) journalDocuments(shard int, keys [][]byte) {
+	values := make([][]byte, len(keys))
+	for i := range values {
+		values[i] = []byte{}
+	}
+	engine.journalLock.RLock()
+	engine.journalLock.journals[shard].SetBatch(keys, values)
+	engine.journalLock.RUnlock()
+}
+
+// 重新索引检查点 checkpoint 之后的日志中记录的文档，已从持久存储删除的文档也从索引中删除
+func (engine *Engine) persistentStorageReplayWorker(shard int, checkpoint uint64) {
+	for _, c := range engine.checkpointsOfFiles(journalFilePrefix) {
+		if c < checkpoint {
+			continue
+		}
+		journal, err := storage.OpenStorage(engine.checkpointFilePath(journalFilePrefix, c, shard))
+		if err != nil {
+			log.Fatal("无法打开日志", err)
+		}
+		journal.ForEach(func(k, v []byte) error {
+			docId, _ := binary.Uvarint(k)
+			value, err := engine.dbs[shard].Get(k)
+			if err != nil {
+				return nil
+			}
+			if value == nil {
+				engine.internalRemoveDocument(docId)
+				return nil
+			}
+			var data types.DocumentIndexData
+			if gob.NewDecoder(bytes.NewReader(value)).Decode(&data) == nil {
+				engine.internalIndexDocument(docId, data, false, false)
+			}
+			return nil
+		})
+		journal.Close()
+	}
+	engine.persistentStorageInitChannel <- true
+}
+
+// 把各 shard 的索引写入新的检查点，重启时直接读入，只需重新索引检查点之后写入的文档
+// 保存期间可以继续加入文档和查找，函数返回时检查点已经生效
+func (engine *Engine) Checkpoint() error {
+	if !engine.initialized {
+		log.Fatal("必须先初始化引擎")
+	}
+	if !engine.initOptions.UsePersistentStorage {
+		return errors.New("未启用持久存储，无法保存检查点")
+	}
+	engine.checkpointLock.Lock()
+	defer engine.checkpointLock.Unlock()
+
+	// 先切换到新的日志，切换之后写入的文档不一定包含在本次检查点中
+	checkpoint := engine.journalLock.checkpoint + 1
+	journals, err := engine.openJournals(checkpoint)
+	if err != nil {
+		return err
+	}
+	engine.journalLock.Lock()
+	oldJournals := engine.journalLock.journals
+	engine.journalLock.checkpoint = checkpoint
+	engine.journalLock.journals = journals
+	engine.journalLock.Unlock()
+	for _, journal := range oldJournals {
+		journal.Close()
+	}
+
+	// 切换之前写入的文档都已提交给索引器，刷新后全部包含在索引中
+	engine.FlushIndex()
+	for shard := range engine.indexers {
+		path := engine.checkpointFilePath(indexFilePrefix, checkpoint, shard)
+		if err := writeFileAtomically(path, engine.indexers[shard].Save); err != nil {
+			return err
+		}
+	}
+	// 映射在索引之后保存，包含索引中的全部文档序号
+	engine.flushDocKeys()
+	path := engine.storagePath(fmt.Sprintf("%s.%d", docIdsFilePrefix, checkpoint))
+	if err := writeFileAtomically(path, engine.writeDocIds); err != nil {
+		return err
+	}
+	manifest := indexManifest{
+		Version:    indexManifestVersion,
+		Checkpoint: checkpoint,
+		NumShards:  engine.initOptions.NumShards,
+		Settings:   engine.indexSettings(),
+	}
+	err = writeFileAtomically(engine.storagePath(indexManifestFile), func(w io.Writer) error {
+		return gob.NewEncoder(w).Encode(manifest)
+	})
+	if err != nil {
+		return err
+	}
+
+	// 新的检查点已经生效，旧的日志和索引文件不再需要
+	engine.removeCheckpointFiles(journalFilePrefix, checkpoint)
+	engine.removeCheckpointFiles(indexFilePrefix, checkpoint)
+	engine.removeCheckpointFiles(docIdsFilePrefix, checkpoint)
+	return nil
+}
+
+// 先写入临时文件再改名，保证文件要么是完整的要么保持原样
+func writeFileAtomically(path string, write func(w io.Writer) error) error {
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if err = write(file); err == nil {
+		err = file.Sync()
+	}
+	if e := file.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"github.com/huichen/wukong/utils"
+	"octopus/types"
+	"os"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"testing"
+)
+
+// 等待持久存储写入完毕后关闭数据库，不保存检查点，模拟进程退出
+func stopEngine(engine *Engine) {
+	engine.FlushIndex()
+	for atomic.LoadUint32(&engine.numStoringRequests) != atomic.LoadUint32(&engine.numDocumentsStored) {
+		runtime.Gosched()
+	}
+	for _, db := range engine.dbs {
+		db.Close()
+	}
+	for _, journal := range engine.journalLock.journals {
+		journal.Close()
+	}
+	engine.docKeys.db.Close()
+}
+
+func searchDocIds(engine *Engine, text string) (docIds []uint64) {
+	for _, doc := range engine.Search(types.SearchRequest{Text: text}).Docs {
+		docIds = append(docIds, doc.DocId)
+	}
+	sort.Slice(docIds, func(i, j int) bool { return docIds[i] < docIds[j] })
+	return
+}
+
+func TestCheckpointRecovery(t *testing.T) {
+	options := EngineInitOptions{
+		NumShards:               2,
+		KeywordExtraction:       TermFrequencyExtraction,
+		UsePersistentStorage:    true,
+		PersistentStorageFolder: t.TempDir(),
+		PersistentStorageShards: 2,
+	}
+	var engine Engine
+	engine.Init(options)
+	for docId := uint64(1); docId <= 4; docId++ {
+		engine.IndexDocument(docId, types.DocumentIndexData{Content: "golang"}, false)
+	}
+	engine.FlushIndex()
+	utils.Expect(t, "<nil>", engine.Checkpoint())
+
+	// 检查点之后的修改记录在日志中，重启时重新执行
+	engine.IndexDocument(5, types.DocumentIndexData{Content: "golang rust"}, false)
+	engine.IndexDocument(2, types.DocumentIndexData{Content: "rust"}, false)
+	engine.RemoveDocument(1)
+	stopEngine(&engine)
+
+	var restarted Engine
+	restarted.Init(options)
+	// 重启后索引器 ADDCACHE 中的文档需要刷新后才能搜索到
+	restarted.FlushIndex()
+	utils.Expect(t, "[3 4 5]", searchDocIds(&restarted, "golang"))
+	utils.Expect(t, "[2 5]", searchDocIds(&restarted, "rust"))
+	utils.Expect(t, "4", restarted.NumDocuments())
+	utils.Expect(t, "<nil>", restarted.Checkpoint())
+	restarted.RemoveDocument(3)
+	stopEngine(&restarted)
+
+	// 有一个 shard 的索引文件损坏时从持久存储重建，已读入的 shard 中被删除的文档不能留下
+	path := restarted.checkpointFilePath(indexFilePrefix, restarted.journalLock.checkpoint, 1)
+	utils.Expect(t, "<nil>", os.WriteFile(path, []byte("broken"), 0600))
+	var rebuilt Engine
+	rebuilt.Init(options)
+	rebuilt.FlushIndex()
+	utils.Expect(t, "[4 5]", searchDocIds(&rebuilt, "golang"))
+	utils.Expect(t, "3", rebuilt.NumDocuments())
+	stopEngine(&rebuilt)
+
+	// 生成关键词的选项改变时不使用检查点
+	options.UseBigramIndex = true
+	var changed Engine
+	changed.Init(options)
+	changed.FlushIndex()
+	_, loaded := changed.loadCheckpoint()
+	utils.Expect(t, "false", loaded)
+	utils.Expect(t, "[4 5]", searchDocIds(&changed, "golang"))
+	stopEngine(&changed)
+}
+
+func TestBulkLoad(t *testing.T) {
+	options := EngineInitOptions{
+		KeywordExtraction:       TermFrequencyExtraction,
+		UsePersistentStorage:    true,
+		PersistentStorageFolder: t.TempDir(),
+		BulkLoad:                true,
+	}
+	var builder Engine
+	builder.Init(options)
+	for docId := uint64(1); docId <= 3; docId++ {
+		builder.IndexDocument(docId, types.DocumentIndexData{Content: "golang"}, false)
+	}
+	for atomic.LoadUint32(&builder.numStoringRequests) != atomic.LoadUint32(&builder.numDocumentsStored) {
+		runtime.Gosched()
+	}
+	// 文档写入持久存储，但不记录在日志中
+	numStored, numJournaled := 0, 0
+	builder.dbs[0].ForEach(func(k, v []byte) error {
+		numStored++
+		return nil
+	})
+	builder.journalLock.journals[0].ForEach(func(k, v []byte) error {
+		numJournaled++
+		return nil
+	})
+	utils.Expect(t, "[3 0]", []int{numStored, numJournaled})
+	builder.Close()
+
+	// 重启时从 Close 保存的检查点读入
+	options.BulkLoad = false
+	var engine Engine
+	engine.Init(options)
+	utils.Expect(t, "1", engine.journalLock.checkpoint)
+	utils.Expect(t, "[1 2 3]", searchDocIds(&engine, "golang"))
+	engine.Close()
+}
@@ -0,0 +1,201 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"github.com/yanyiwu/gojieba"
+	"log"
+	"octopus/types"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 用户词典中的一个词条
+type userWord struct {
+	word string
+	freq int
+	tag  string
+}
+
+// 读取用户词典文件
+// 每行一个词条，格式为 "词语 [词频] [词性]"，空行和以 # 开头的行被忽略
+func loadUserDictionary(path string) ([]userWord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []userWord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		word := userWord{word: fields[0]}
+		if len(fields) > 1 {
+			if freq, err := strconv.Atoi(fields[1]); err == nil {
+				word.freq = freq
+			}
+		}
+		if len(fields) > 2 {
+			word.tag = fields[2]
+		}
+		words = append(words, word)
+	}
+	return words, scanner.Err()
+}
+
+// 创建分词器并加入全部用户词典中的词条
+// 分词的文本已经过归一化，词条用同样的 normalize 处理后才能匹配
+func newSegmenter(dictionaryFiles []string, normalize func(string) string) (*gojieba.Jieba, map[string]bool, error) {
+	var words []userWord
+	for _, path := range dictionaryFiles {
+		fileWords, err := loadUserDictionary(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("无法读取用户词典 %s: %v", path, err)
+		}
+		words = append(words, fileWords...)
+	}
+
+	jieba := gojieba.NewJieba()
+	userWords := make(map[string]bool, len(words))
+	for _, word := range words {
+		word.word = normalize(word.word)
+		if word.freq > 0 {
+			jieba.AddWordEx(word.word, word.freq, word.tag)
+		} else {
+			jieba.AddWord(word.word)
+		}
+		userWords[word.word] = true
+	}
+	return jieba, userWords, nil
+}
+
+// 初始化分词器，词典加载失败时直接退出
+func (engine *Engine) initSegmenter() {
+	jieba, userWords, err := newSegmenter(engine.initOptions.UserDictionaryFiles, engine.initOptions.Normalization.normalize)
+	if err != nil {
+		log.Fatal(err)
+	}
+	synonyms, err := loadSynonyms(engine.initOptions.SynonymFiles, engine.analyzeWord)
+	if err != nil {
+		log.Fatal(err)
+	}
+	engine.segmenterLock.jieba = jieba
+	engine.segmenterLock.userWords = userWords
+	engine.segmenterLock.synonyms = synonyms
+}
+
+// 重新读取用户词典和同义词文件并替换正在使用的分词器，此函数线程安全
+// 返回相对上次加载新增和删除的词条，包含这些词条的文档分词结果可能改变，可用于 ReindexStoredDocuments
+// 同义词只在查询时使用，修改后不需要重建索引
+func (engine *Engine) ReloadDictionary() (added []string, removed []string, err error) {
+	if !engine.initialized {
+		log.Fatal("必须先初始化引擎")
+	}
+	synonyms, err := loadSynonyms(engine.initOptions.SynonymFiles, engine.analyzeWord)
+	if err != nil {
+		return nil, nil, err
+	}
+	jieba, userWords, err := newSegmenter(engine.initOptions.UserDictionaryFiles, engine.initOptions.Normalization.normalize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	engine.segmenterLock.Lock()
+	oldJieba := engine.segmenterLock.jieba
+	oldUserWords := engine.segmenterLock.userWords
+	engine.segmenterLock.jieba = jieba
+	engine.segmenterLock.userWords = userWords
+	engine.segmenterLock.synonyms = synonyms
+	engine.segmenterLock.Unlock()
+	// 写锁保证了此时没有协程仍在使用旧的分词器
+	oldJieba.Free()
+
+	for word := range userWords {
+		if !oldUserWords[word] {
+			added = append(added, word)
+		}
+	}
+	for word := range oldUserWords {
+		if !userWords[word] {
+			removed = append(removed, word)
+		}
+	}
+	return added, removed, nil
+}
+
+// 对文本做搜索引擎模式分词
+func (engine *Engine) cutForSearch(text string) []string {
+	engine.segmenterLock.RLock()
+	defer engine.segmenterLock.RUnlock()
+	return engine.segmenterLock.jieba.CutForSearch(text, true)
+}
+
+// 对文本做精确模式分词
+func (engine *Engine) cut(text string) []string {
+	engine.segmenterLock.RLock()
+	defer engine.segmenterLock.RUnlock()
+	return engine.segmenterLock.jieba.Cut(text, true)
+}
+
+// 按 TF-IDF 提取文本中权重最高的 topK 个关键词
+func (engine *Engine) extractWithWeight(text string, topK int) []gojieba.WordWeight {
+	engine.segmenterLock.RLock()
+	defer engine.segmenterLock.RUnlock()
+	return engine.segmenterLock.jieba.ExtractWithWeight(text, topK)
+}
+
+// 重新分词并索引持久存储中生成关键词的文本包含 words 中任一词语的文档
+// 文本和分词时一样先去掉标记并归一化，words 应为归一化后的词语，如 ReloadDictionary 的返回值
+// words 为空时重建全部文档的索引。返回被重新索引的文档数
+// 函数返回时新的索引已经生效
+func (engine *Engine) ReindexStoredDocuments(words []string) (int, error) {
+	if !engine.initialized {
+		log.Fatal("必须先初始化引擎")
+	}
+	if !engine.initOptions.UsePersistentStorage {
+		return 0, errors.New("未启用持久存储，无法重建索引")
+	}
+
+	// 边读取边重新索引，不在内存中保存全部文档
+	numDocuments := 0
+	for shard := 0; shard < engine.initOptions.PersistentStorageShards; shard++ {
+		err := engine.dbs[shard].ForEach(func(k, v []byte) error {
+			docId, _ := binary.Uvarint(k)
+			var data types.DocumentIndexData
+			if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&data); err != nil {
+				return nil
+			}
+			// 文档内容不变时分配到同一个 shard，索引器会用新的关键词替换旧的索引项
+			if len(words) == 0 || containsAny(engine.keywordText(data), words) {
+				engine.internalIndexDocument(docId, data, false, false)
+				numDocuments++
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	engine.FlushIndex()
+	return numDocuments, nil
+}
+
+func containsAny(text string, words []string) bool {
+	for _, word := range words {
+		if strings.Contains(text, word) {
+			return true
+		}
+	}
+	return false
+}
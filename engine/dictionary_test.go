@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"github.com/huichen/wukong/utils"
+	"octopus/types"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReloadDictionary(t *testing.T) {
+	folder := t.TempDir()
+	dictionary := filepath.Join(folder, "user.dict")
+	utils.Expect(t, "<nil>", os.WriteFile(dictionary, []byte("恋愛\n"), 0600))
+	var engine Engine
+	engine.Init(EngineInitOptions{
+		KeywordExtraction:       TermFrequencyExtraction,
+		ContentFormat:           HTMLContent,
+		UserDictionaryFiles:     []string{dictionary},
+		Normalization:           NormalizationOptions{TraditionalToSimplified: true},
+		UsePersistentStorage:    true,
+		PersistentStorageFolder: filepath.Join(folder, "storage"),
+	})
+	engine.IndexDocument(1, types.DocumentIndexData{Content: "<b>恋</b>愛故事"}, false)
+	engine.IndexDocument(2, types.DocumentIndexData{Content: "故事"}, false)
+	engine.IndexDocument(3, types.DocumentIndexData{Content: "婚姻"}, false)
+	engine.FlushIndex()
+	for atomic.LoadUint32(&engine.numStoringRequests) != atomic.LoadUint32(&engine.numDocumentsStored) {
+		runtime.Gosched()
+	}
+	// 词条和正文经过同样的归一化
+	utils.Expect(t, "1", engine.DocumentFrequency("恋爱"))
+
+	utils.Expect(t, "<nil>", os.WriteFile(dictionary, []byte("故事\n"), 0600))
+	added, removed, err := engine.ReloadDictionary()
+	utils.Expect(t, "[[故事] [恋爱] <nil>]", []interface{}{added, removed, err})
+
+	// 只重新索引去掉标记并归一化后包含新增或删除词条的文档
+	numDocuments, err := engine.ReindexStoredDocuments(append(added, removed...))
+	utils.Expect(t, "[2 <nil>]", []interface{}{numDocuments, err})
+	utils.Expect(t, "0", engine.DocumentFrequency("恋爱"))
+	utils.Expect(t, "2", engine.DocumentFrequency("故事"))
+	numDocuments, _ = engine.ReindexStoredDocuments([]string{"恋愛"})
+	utils.Expect(t, "0", numDocuments)
+	engine.Close()
+}
@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"octopus/storage"
+	"octopus/types"
+)
+
+// 上游系统用 "answer:123456"、UUID 等字符串标识文档，这里为每个字符串 ID 分配一个 DocId
+// 分配的 DocId 从 keyedDocIdBase 开始依次递增，调用者直接使用的数字 DocId 应小于它
+// 之后的分词、索引、持久存储和检查点都和数字 DocId 的文档相同，DocId 再由 doc_ordinals.go 映射为内部序号
+// 启用持久存储时映射保存在 zuiyou.keys 中，文档被删除后映射仍然保留
+// 新分配的映射在写入引用它的文档或保存检查点之前批量写入，见 flushDocKeys
+const keyedDocIdBase uint64 = 1 << 63
+
+// 调用者直接使用的数字 DocId 的最大值，更大的 DocId 保留给字符串 ID
+const MaxDocId = keyedDocIdBase - 1
+
+const docKeysFile = PersistentStorageFilePrefix + ".keys"
+
+func (engine *Engine) initDocKeys() {
+	engine.docKeys.docIds = make(map[string]uint64)
+	engine.docKeys.keys = make(map[uint64]string)
+	engine.docKeys.next = keyedDocIdBase
+}
+
+// 打开持久存储中的映射并全部读入内存
+func (engine *Engine) openDocKeys() {
+	db, err := storage.OpenStorage(engine.storagePath(docKeysFile))
+	if db == nil || err != nil {
+		log.Fatal("无法打开数据库", engine.storagePath(docKeysFile), ": ", err)
+	}
+	engine.docKeys.db = db
+	db.ForEach(func(k, v []byte) error {
+		docId, _ := binary.Uvarint(v)
+		engine.docKeys.docIds[string(k)] = docId
+		engine.docKeys.keys[docId] = string(k)
+		if docId >= engine.docKeys.next {
+			engine.docKeys.next = docId + 1
+		}
+		return nil
+	})
+	fmt.Println("读入字符串 ID 数:", len(engine.docKeys.docIds))
+}
+
+// 得到字符串 ID 对应的 DocId，尚未分配时分配新的 DocId，由 flushDocKeys 写入持久存储
+func (engine *Engine) docIdOfKey(key string) uint64 {
+	engine.docKeys.RLock()
+	docId, found := engine.docKeys.docIds[key]
+	engine.docKeys.RUnlock()
+	if found {
+		return docId
+	}
+
+	engine.docKeys.Lock()
+	defer engine.docKeys.Unlock()
+	if docId, found := engine.docKeys.docIds[key]; found {
+		return docId
+	}
+	docId = engine.docKeys.next
+	engine.docKeys.next++
+	engine.docKeys.docIds[key] = docId
+	engine.docKeys.keys[docId] = key
+	if engine.docKeys.db != nil {
+		engine.docKeys.pending = append(engine.docKeys.pending, key)
+	}
+	return docId
+}
+
+// 在一个事务中写入尚未保存的映射
+// 持久存储协程写入文档之前调用，保证重启后持久存储中的 DocId 都能找到对应的字符串 ID
+func (engine *Engine) flushDocKeys() {
+	engine.docKeys.flushLock.Lock()
+	defer engine.docKeys.flushLock.Unlock()
+	engine.docKeys.Lock()
+	pending := engine.docKeys.pending
+	engine.docKeys.pending = nil
+	keys := make([][]byte, len(pending))
+	values := make([][]byte, len(pending))
+	for i, key := range pending {
+		value := make([]byte, binary.MaxVarintLen64)
+		length := binary.PutUvarint(value, engine.docKeys.docIds[key])
+		keys[i], values[i] = []byte(key), value[:length]
+	}
+	engine.docKeys.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+	if err := engine.docKeys.db.SetBatch(keys, values); err != nil {
+		log.Fatal("无法保存字符串 ID 映射: ", err)
+	}
+}
+
+// 得到已分配的 DocId，不分配新的 DocId
+func (engine *Engine) lookupDocIdOfKey(key string) (uint64, bool) {
+	engine.docKeys.RLock()
+	defer engine.docKeys.RUnlock()
+	docId, found := engine.docKeys.docIds[key]
+	return docId, found
+}
+
+// DocId 对应的字符串 ID，不是用字符串 ID 加入的文档返回空字符串
+func (engine *Engine) keyOfDocId(docId uint64) string {
+	if docId < keyedDocIdBase {
+		return ""
+	}
+	engine.docKeys.RLock()
+	defer engine.docKeys.RUnlock()
+	return engine.docKeys.keys[docId]
+}
+
+// 用字符串 ID 标识的文档加入索引，key 为空时忽略文档，其他参数同 IndexDocument
+// 搜索结果中的 ScoredDocument.Key 为该字符串 ID
+func (engine *Engine) IndexDocumentByKey(key string, data types.DocumentIndexData, forceUpdate bool) {
+	if !engine.initialized {
+		log.Fatal("必须先初始化引擎")
+	}
+	if key == "" {
+		fmt.Println("字符串 ID 为空，忽略文档")
+		if forceUpdate {
+			engine.internalIndexDocument(0, types.DocumentIndexData{}, true, false)
+		}
+		return
+	}
+	engine.indexDocument(engine.docIdOfKey(key), data, forceUpdate)
+}
+
+// 删除用字符串 ID 加入的文档，见 RemoveDocument
+func (engine *Engine) RemoveDocumentByKey(key string) {
+	if !engine.initialized {
+		log.Fatal("必须先初始化引擎")
+	}
+	if docId, found := engine.lookupDocIdOfKey(key); found {
+		engine.RemoveDocument(docId)
+	}
+}
@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"github.com/huichen/wukong/utils"
+	"octopus/types"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"testing"
+)
+
+func searchKeys(engine *Engine, text string) (keys []string) {
+	for _, doc := range engine.Search(types.SearchRequest{Text: text}).Docs {
+		keys = append(keys, doc.Key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+func TestDocKeys(t *testing.T) {
+	options := EngineInitOptions{
+		KeywordExtraction:       TermFrequencyExtraction,
+		UsePersistentStorage:    true,
+		PersistentStorageFolder: t.TempDir(),
+	}
+	var engine Engine
+	engine.Init(options)
+	engine.IndexDocumentByKey("answer:1", types.DocumentIndexData{Content: "golang"}, false)
+	engine.IndexDocumentByKey("answer:2", types.DocumentIndexData{Content: "golang"}, false)
+	engine.IndexDocumentByKey("answer:1", types.DocumentIndexData{Content: "golang rust"}, false)
+	// 空的字符串 ID 被忽略
+	engine.IndexDocumentByKey("", types.DocumentIndexData{Content: "golang"}, false)
+	engine.IndexDocument(1, types.DocumentIndexData{Content: "golang"}, false)
+	engine.FlushIndex()
+	utils.Expect(t, "[ answer:1 answer:2]", searchKeys(&engine, "golang"))
+	utils.Expect(t, "[9223372036854775808]", searchDocIds(&engine, "rust"))
+
+	// 映射在文档写入持久存储之前写入
+	for atomic.LoadUint32(&engine.numStoringRequests) != atomic.LoadUint32(&engine.numDocumentsStored) {
+		runtime.Gosched()
+	}
+	utils.Expect(t, "0", len(engine.docKeys.pending))
+	engine.RemoveDocumentByKey("answer:2")
+	engine.RemoveDocumentByKey("answer:3")
+	stopEngine(&engine)
+
+	// 重启后沿用原来的映射，删除的文档的映射仍然保留
+	var restarted Engine
+	restarted.Init(options)
+	restarted.FlushIndex()
+	utils.Expect(t, "[ answer:1]", searchKeys(&restarted, "golang"))
+	utils.Expect(t, "9223372036854775809", restarted.docIdOfKey("answer:2"))
+	utils.Expect(t, "9223372036854775810", restarted.docIdOfKey("answer:3"))
+	restarted.Close()
+}
@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"os"
+)
+
+// 索引器内部用 uint32 的序号标识文档，倒排表和位图都按序号压缩
+// 引擎把 64 位的 DocId 映射为全部 shard 中唯一的序号，搜索结果再换回 DocId
+// 序号从 1 开始依次分配，0 和 DocId 0 一样表示非法文档
+// 文档被删除后映射仍然保留，再次加入时沿用原来的序号，保证正在处理的请求不会指向别的文档
+
+var errDocIdsFile = errors.New("DocId 映射文件已损坏")
+
+// 得到 DocId 对应的序号，尚未分配时分配新的序号
+func (engine *Engine) ordinalOf(docId uint64) uint32 {
+	if docId == 0 {
+		return 0
+	}
+	engine.docOrdinals.RLock()
+	ordinal, found := engine.docOrdinals.ordinals[docId]
+	engine.docOrdinals.RUnlock()
+	if found {
+		return ordinal
+	}
+
+	engine.docOrdinals.Lock()
+	defer engine.docOrdinals.Unlock()
+	if ordinal, found := engine.docOrdinals.ordinals[docId]; found {
+		return ordinal
+	}
+	if len(engine.docOrdinals.docIds) > math.MaxUint32 {
+		log.Fatal("文档数超过索引器的上限")
+	}
+	ordinal = uint32(len(engine.docOrdinals.docIds))
+	engine.docOrdinals.ordinals[docId] = ordinal
+	engine.docOrdinals.docIds = append(engine.docOrdinals.docIds, docId)
+	return ordinal
+}
+
+// 得到已分配的序号，不分配新的序号
+func (engine *Engine) lookupOrdinal(docId uint64) (uint32, bool) {
+	engine.docOrdinals.RLock()
+	defer engine.docOrdinals.RUnlock()
+	ordinal, found := engine.docOrdinals.ordinals[docId]
+	return ordinal, found
+}
+
+// 序号对应的 DocId
+func (engine *Engine) docIdOf(ordinal uint32) uint64 {
+	engine.docOrdinals.RLock()
+	defer engine.docOrdinals.RUnlock()
+	if int(ordinal) >= len(engine.docOrdinals.docIds) {
+		return 0
+	}
+	return engine.docOrdinals.docIds[ordinal]
+}
+
+func (engine *Engine) initDocOrdinals(docIds []uint64) {
+	engine.docOrdinals.Lock()
+	defer engine.docOrdinals.Unlock()
+	engine.docOrdinals.ordinals = make(map[uint64]uint32, len(docIds))
+	engine.docOrdinals.docIds = docIds
+	for ordinal, docId := range docIds {
+		if ordinal > 0 {
+			engine.docOrdinals.ordinals[docId] = uint32(ordinal)
+		}
+	}
+}
+
+// 写入按序号排列的全部 DocId，每个为小端序 uint64，第一个是序号 0 的占位
+func (engine *Engine) writeDocIds(w io.Writer) error {
+	engine.docOrdinals.RLock()
+	docIds := engine.docOrdinals.docIds
+	engine.docOrdinals.RUnlock()
+
+	writer := bufio.NewWriter(w)
+	var buffer [8]byte
+	for _, docId := range docIds {
+		binary.LittleEndian.PutUint64(buffer[:], docId)
+		if _, err := writer.Write(buffer[:]); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+func readDocIds(path string) ([]uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%8 != 0 || len(data) == 0 {
+		return nil, errDocIdsFile
+	}
+	docIds := make([]uint64, len(data)/8)
+	for i := range docIds {
+		docIds[i] = binary.LittleEndian.Uint64(data[i*8:])
+	}
+	return docIds, nil
+}
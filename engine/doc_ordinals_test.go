@@ -0,0 +1,41 @@
+package engine
+
+import (
+	"github.com/huichen/wukong/utils"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDocOrdinals(t *testing.T) {
+	var engine Engine
+	engine.initDocOrdinals([]uint64{0})
+	utils.Expect(t, "0", engine.ordinalOf(0))
+	utils.Expect(t, "1", engine.ordinalOf(100))
+	utils.Expect(t, "2", engine.ordinalOf(keyedDocIdBase))
+	utils.Expect(t, "1", engine.ordinalOf(100))
+	_, found := engine.lookupOrdinal(7)
+	utils.Expect(t, "false", found)
+	utils.Expect(t, "9223372036854775808", engine.docIdOf(2))
+	utils.Expect(t, "0", engine.docIdOf(3))
+
+	// 写入检查点的映射读入后序号不变
+	path := filepath.Join(t.TempDir(), "docids")
+	file, _ := os.Create(path)
+	utils.Expect(t, "<nil>", engine.writeDocIds(file))
+	file.Close()
+	docIds, err := readDocIds(path)
+	utils.Expect(t, "[[0 100 9223372036854775808] <nil>]", []interface{}{docIds, err})
+	var restored Engine
+	restored.initDocOrdinals(docIds)
+	utils.Expect(t, "2", restored.ordinalOf(keyedDocIdBase))
+	utils.Expect(t, "3", restored.ordinalOf(7))
+
+	// 长度不是 8 的倍数或为空的文件已损坏
+	os.WriteFile(path, make([]byte, 12), 0600)
+	_, err = readDocIds(path)
+	utils.Expect(t, errDocIdsFile.Error(), err)
+	os.WriteFile(path, nil, 0600)
+	_, err = readDocIds(path)
+	utils.Expect(t, errDocIdsFile.Error(), err)
+}
@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"octopus/types"
+)
+
+// 文档所在的 shard 由 DocId 和内容的哈希值决定，内容改变后文档可能被分到另一个 shard
+// 这里记录每个文档当前所在的 shard，文档换 shard 时从原来的 shard 中删除
+// 保证每个文档只在一个 shard 中，各 shard 的文档数和关键词统计相加就是全局的精确值
+//
+// 同一文档的几个版本可能同时在不同的分词器协程中处理，完成的顺序不确定
+// 每次加入和删除文档时分配递增的版本号，送入索引器通道时在锁内比较，比已处理的版本旧的请求被丢弃
+// 从原 shard 删除和加入新 shard 也在锁内依次送入通道，各索引器协程按通道顺序处理，不会把文档留在两个 shard 中
+
+type documentShard struct {
+	shard   uint32
+	version uint64
+
+	// 文档已被删除，不在任何 shard 中
+	removed bool
+}
+
+// 分配新的版本号，加入和删除文档的请求在送入分词器通道前调用
+func (engine *Engine) nextDocumentVersion() uint64 {
+	engine.docShards.Lock()
+	defer engine.docShards.Unlock()
+	engine.docShards.version++
+	return engine.docShards.version
+}
+
+// 把分词后的文档送入 shard 的索引器协程，文档原来在另一个 shard 中时先从原来的 shard 中删除
+// 文档已有更新的版本或已在之后被删除时不做任何事并返回 false
+func (engine *Engine) addToShard(ordinal uint32, version uint64, shard uint32, request IndexerAddDocumentRequest) bool {
+	engine.docShards.Lock()
+	defer engine.docShards.Unlock()
+	current, found := engine.docShards.shards[ordinal]
+	if found && current.version > version {
+		return false
+	}
+	if found && !current.removed && current.shard != shard {
+		engine.removeFromShard(current.shard, ordinal)
+	}
+	engine.docShards.shards[ordinal] = documentShard{shard: shard, version: version}
+	if fingerprint, found := request.document.Fields[types.SimHashField]; found && engine.initOptions.DetectNearDuplicates {
+		// 指纹和文档所在的 shard 一样只保留最新的版本
+		engine.addSimHash(ordinal, uint64(fingerprint))
+	}
+	engine.indexerAddDocChannels[shard] <- request
+	return true
+}
+
+// 从文档所在的 shard 中删除文档，之后处理完的旧版本不会再被加入
+func (engine *Engine) removeFromShards(ordinal uint32, version uint64) {
+	engine.docShards.Lock()
+	defer engine.docShards.Unlock()
+	current, found := engine.docShards.shards[ordinal]
+	if found && current.version > version {
+		return
+	}
+	engine.removeSimHash(ordinal)
+	if found && !current.removed {
+		engine.removeFromShard(current.shard, ordinal)
+	}
+	engine.docShards.shards[ordinal] = documentShard{version: version, removed: true}
+}
+
+// 读入检查点后由各 shard 中的文档重建记录
+// 早期版本的检查点中同一文档可能在多个 shard 中，按持久存储中的内容确定所在的 shard，从其他 shard 中删除
+func (engine *Engine) initDocumentShards() {
+	found := make(map[uint32][]uint32)
+	for shard := range engine.indexers {
+		for _, docId := range engine.indexers[shard].DocIds() {
+			found[docId] = append(found[docId], uint32(shard))
+		}
+	}
+
+	numDuplicates := 0
+	engine.docShards.Lock()
+	for docId, shards := range found {
+		shard := shards[0]
+		if len(shards) > 1 {
+			numDuplicates++
+			if s, ok := engine.storedDocumentShard(engine.docIdOf(docId)); ok {
+				shard = s
+			}
+			for _, s := range shards {
+				if s != shard {
+					engine.indexers[s].RemoveDocument(docId)
+				}
+			}
+		}
+		engine.docShards.shards[docId] = documentShard{shard: shard}
+	}
+	engine.docShards.Unlock()
+	if numDuplicates > 0 {
+		fmt.Println("检查点中重复的文档数:", numDuplicates)
+	}
+}
+
+// 按持久存储中的文档内容计算文档应在的 shard
+func (engine *Engine) storedDocumentShard(docId uint64) (uint32, bool) {
+	key := make([]byte, binary.MaxVarintLen64)
+	length := binary.PutUvarint(key, docId)
+	value, err := engine.dbs[engine.persistentStorageShard(docId)].Get(key[:length])
+	if err != nil || value == nil {
+		return 0, false
+	}
+	var data types.DocumentIndexData
+	if gob.NewDecoder(bytes.NewReader(value)).Decode(&data) != nil {
+		return 0, false
+	}
+	return engine.getShard(engine.documentHash(docId, data.Content)), true
+}
@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/huichen/wukong/utils"
+	"octopus/types"
+	"testing"
+)
+
+func TestDocumentShardVersions(t *testing.T) {
+	var engine Engine
+	engine.docShards.shards = make(map[uint32]documentShard)
+	engine.indexerAddDocChannels = []chan IndexerAddDocumentRequest{
+		make(chan IndexerAddDocumentRequest, 10), make(chan IndexerAddDocumentRequest, 10)}
+	// 依次取出送入各 shard 索引器通道的请求
+	received := func() (requests []string) {
+		for shard, channel := range engine.indexerAddDocChannels {
+			for len(channel) > 0 {
+				request := <-channel
+				if request.removeDocId != 0 {
+					requests = append(requests, fmt.Sprintf("%d:remove %d", shard, request.removeDocId))
+				} else {
+					requests = append(requests, fmt.Sprintf("%d:add %d", shard, request.document.DocId))
+				}
+			}
+		}
+		return
+	}
+	add := func(ordinal uint32, version uint64, shard uint32) bool {
+		return engine.addToShard(ordinal, version, shard,
+			IndexerAddDocumentRequest{document: &types.DocumentIndex{DocId: ordinal}})
+	}
+
+	version1, version2, version3 := engine.nextDocumentVersion(), engine.nextDocumentVersion(), engine.nextDocumentVersion()
+	utils.Expect(t, "[1 2 3]", []uint64{version1, version2, version3})
+
+	// 新版本先处理完，旧版本被丢弃
+	utils.Expect(t, "true", add(1, version2, 0))
+	utils.Expect(t, "false", add(1, version1, 1))
+	utils.Expect(t, "[0:add 1]", received())
+
+	// 内容改变后分到另一个 shard，先从原来的 shard 删除
+	utils.Expect(t, "true", add(1, version3, 1))
+	utils.Expect(t, "[0:remove 1 1:add 1]", received())
+
+	// 比已处理的版本旧的删除请求被丢弃
+	engine.removeFromShards(1, version2)
+	utils.Expect(t, "[]", received())
+
+	// 删除之后处理完的旧版本不会再被加入
+	version4 := engine.nextDocumentVersion()
+	engine.removeFromShards(1, version4)
+	utils.Expect(t, "[1:remove 1]", received())
+	utils.Expect(t, "false", add(1, version3, 0))
+	utils.Expect(t, "{0 4 true}", engine.docShards.shards[1])
+
+	// 已删除的文档重新加入时不需要从任何 shard 删除
+	utils.Expect(t, "true", add(1, engine.nextDocumentVersion(), 0))
+	utils.Expect(t, "[0:add 1]", received())
+}
@@ -0,0 +1,256 @@
+package engine
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/bits"
+	"octopus/core"
+	"octopus/types"
+	"sort"
+)
+
+// 文档全部数据的指纹，包括标题、正文和数值字段，任何一项改变都需要重新索引
+func contentHash(data types.DocumentIndexData) uint64 {
+	hash := fnv.New64a()
+	var buffer [8]byte
+	writeString := func(s string) {
+		binary.LittleEndian.PutUint64(buffer[:], uint64(len(s)))
+		hash.Write(buffer[:])
+		hash.Write([]byte(s))
+	}
+	writeNumber := func(v int64) {
+		binary.LittleEndian.PutUint64(buffer[:], uint64(v))
+		hash.Write(buffer[:])
+	}
+	writeString(data.Title)
+	writeString(data.Content)
+	writeNumber(int64(data.PostId))
+	writeNumber(int64(data.CreateTime))
+	writeNumber(int64(data.UpdateTime))
+	names := make([]string, 0, len(data.Fields))
+	for name := range data.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeString(name)
+		writeNumber(data.Fields[name])
+	}
+	return hash.Sum64()
+}
+
+// 记录文档的指纹并为加入请求分配版本号，见 doc_shards.go
+// 比较、记录指纹和分配版本号在同一锁内完成，同时加入的同一文档中版本号最大的请求的指纹最后写入
+// 同样内容的并发请求只有第一个会被索引
+// onlyIfChanged 为 true 且指纹和上次加入时相同时不记录也不分配版本号，返回 false
+func (engine *Engine) recordContentHash(docId uint64, data types.DocumentIndexData, onlyIfChanged bool) (uint64, bool) {
+	if !engine.initOptions.SkipUnchangedDocuments {
+		return engine.nextDocumentVersion(), true
+	}
+	hash := contentHash(data)
+	engine.contentHashes.Lock()
+	defer engine.contentHashes.Unlock()
+	if previous, found := engine.contentHashes.hashes[docId]; onlyIfChanged && found && previous == hash {
+		return 0, false
+	}
+	engine.contentHashes.hashes[docId] = hash
+	return engine.nextDocumentVersion(), true
+}
+
+// 删除文档的指纹并为删除请求分配版本号，和 recordContentHash 一样在同一锁内完成
+func (engine *Engine) forgetContentHash(docId uint64) uint64 {
+	engine.contentHashes.Lock()
+	defer engine.contentHashes.Unlock()
+	delete(engine.contentHashes.hashes, docId)
+	return engine.nextDocumentVersion()
+}
+
+// 由文档的关键词和权重计算 64 位的 SimHash 指纹
+// 每个关键词哈希后按各位为 1 或 0 加上或减去权重，最终为正的位置 1
+// 内容大部分相同的文档指纹只有少数几位不同
+func simHash(keywords map[string]float32) (fingerprint uint64) {
+	var vector [64]float32
+	for word, weight := range keywords {
+		hash := fnv.New64a()
+		hash.Write([]byte(word))
+		h := hash.Sum64()
+		for i := range vector {
+			if h&(1<<uint(i)) != 0 {
+				vector[i] += weight
+			} else {
+				vector[i] -= weight
+			}
+		}
+	}
+	for i, v := range vector {
+		if v > 0 {
+			fingerprint |= 1 << uint(i)
+		}
+	}
+	return
+}
+
+// 指纹分成 SimHashDistance+1 段，汉明距离不超过 SimHashDistance 的两个指纹至少有一段完全相同
+// 查找时只需比较至少一段相同的文档
+func (engine *Engine) simHashBands(fingerprint uint64) []uint64 {
+	numBands := len(engine.simHashes.bands)
+	bands := make([]uint64, numBands)
+	for i := range bands {
+		start, end := i*64/numBands, (i+1)*64/numBands
+		mask := uint64(math.MaxUint64)
+		if end-start < 64 {
+			mask = 1<<uint(end-start) - 1
+		}
+		bands[i] = fingerprint >> uint(start) & mask
+	}
+	return bands
+}
+
+func (engine *Engine) initSimHashes() {
+	numBands := engine.initOptions.SimHashDistance + 1
+	if numBands > 64 {
+		numBands = 64
+	}
+	engine.simHashes.fingerprints = make(map[uint32]uint64)
+	engine.simHashes.bands = make([]map[uint64][]uint32, numBands)
+	for i := range engine.simHashes.bands {
+		engine.simHashes.bands[i] = make(map[uint64][]uint32)
+	}
+}
+
+// 记录文档的指纹，替换文档原有的指纹
+func (engine *Engine) addSimHash(ordinal uint32, fingerprint uint64) {
+	engine.simHashes.Lock()
+	defer engine.simHashes.Unlock()
+	engine.removeSimHashLocked(ordinal)
+	engine.simHashes.fingerprints[ordinal] = fingerprint
+	for i, band := range engine.simHashBands(fingerprint) {
+		engine.simHashes.bands[i][band] = append(engine.simHashes.bands[i][band], ordinal)
+	}
+}
+
+func (engine *Engine) removeSimHash(ordinal uint32) {
+	engine.simHashes.Lock()
+	engine.removeSimHashLocked(ordinal)
+	engine.simHashes.Unlock()
+}
+
+func (engine *Engine) removeSimHashLocked(ordinal uint32) {
+	fingerprint, found := engine.simHashes.fingerprints[ordinal]
+	if !found {
+		return
+	}
+	delete(engine.simHashes.fingerprints, ordinal)
+	for i, band := range engine.simHashBands(fingerprint) {
+		ordinals := engine.simHashes.bands[i][band]
+		for j, o := range ordinals {
+			if o == ordinal {
+				ordinals = append(ordinals[:j], ordinals[j+1:]...)
+				break
+			}
+		}
+		if len(ordinals) == 0 {
+			delete(engine.simHashes.bands[i], band)
+		} else {
+			engine.simHashes.bands[i][band] = ordinals
+		}
+	}
+}
+
+// 读入检查点后由各 shard 保存的 SimHash 字段重建指纹索引
+func (engine *Engine) initSimHashesFromIndex() {
+	for shard := range engine.indexers {
+		docIds := engine.indexers[shard].DocIds()
+		for ordinal, value := range engine.indexers[shard].FieldValues(types.SimHashField, docIds) {
+			engine.addSimHash(ordinal, uint64(value))
+		}
+	}
+}
+
+// 和文档近似重复的其他文档，按汉明距离从小到大排列，此函数线程安全
+// 需要开启 EngineInitOptions.DetectNearDuplicates
+func (engine *Engine) NearDuplicates(docId uint64) (duplicates []types.NearDuplicate) {
+	if !engine.initialized {
+		log.Fatal("必须先初始化引擎")
+	}
+	ordinal, found := engine.lookupOrdinal(docId)
+	if !found {
+		return
+	}
+	engine.simHashes.RLock()
+	fingerprint, found := engine.simHashes.fingerprints[ordinal]
+	if !found {
+		engine.simHashes.RUnlock()
+		return
+	}
+	seen := map[uint32]bool{ordinal: true}
+	for i, band := range engine.simHashBands(fingerprint) {
+		for _, o := range engine.simHashes.bands[i][band] {
+			if seen[o] {
+				continue
+			}
+			seen[o] = true
+			distance := bits.OnesCount64(fingerprint ^ engine.simHashes.fingerprints[o])
+			if distance <= engine.initOptions.SimHashDistance {
+				duplicates = append(duplicates, types.NearDuplicate{DocId: uint64(o), Distance: distance})
+			}
+		}
+	}
+	engine.simHashes.RUnlock()
+
+	for i := range duplicates {
+		duplicates[i].DocId = engine.docIdOf(uint32(duplicates[i].DocId))
+		duplicates[i].Key = engine.keyOfDocId(duplicates[i].DocId)
+	}
+	sort.SliceStable(duplicates, func(i, j int) bool { return duplicates[i].Distance < duplicates[j].Distance })
+	return
+}
+
+// 用字符串 ID 查找近似重复的文档，见 NearDuplicates
+func (engine *Engine) NearDuplicatesByKey(key string) []types.NearDuplicate {
+	if docId, found := engine.lookupDocIdOfKey(key); found {
+		return engine.NearDuplicates(docId)
+	}
+	return nil
+}
+
+// 近似重复的文档只保留排在最前的一个，其余的从结果中去掉
+func (engine *Engine) collapseNearDuplicates(docs core.PairList) core.PairList {
+	engine.simHashes.RLock()
+	defer engine.simHashes.RUnlock()
+	kept := make([]map[uint64][]uint64, len(engine.simHashes.bands))
+	for i := range kept {
+		kept[i] = make(map[uint64][]uint64)
+	}
+	collapsed := docs[:0]
+	for _, doc := range docs {
+		fingerprint, found := engine.simHashes.fingerprints[doc.Key]
+		if !found {
+			collapsed = append(collapsed, doc)
+			continue
+		}
+		bands := engine.simHashBands(fingerprint)
+		duplicate := false
+		for i, band := range bands {
+			for _, f := range kept[i][band] {
+				if bits.OnesCount64(fingerprint^f) <= engine.initOptions.SimHashDistance {
+					duplicate = true
+					break
+				}
+			}
+			if duplicate {
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		for i, band := range bands {
+			kept[i][band] = append(kept[i][band], fingerprint)
+		}
+		collapsed = append(collapsed, doc)
+	}
+	return collapsed
+}
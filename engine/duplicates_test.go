@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"github.com/huichen/wukong/utils"
+	"hash/fnv"
+	"octopus/core"
+	"testing"
+)
+
+func TestSimHash(t *testing.T) {
+	// 只有一个关键词时指纹就是它的哈希值
+	hash := fnv.New64a()
+	hash.Write([]byte("恋爱"))
+	utils.Expect(t, "true", simHash(map[string]float32{"恋爱": 1}) == hash.Sum64())
+	utils.Expect(t, "0", simHash(nil))
+
+	var engine Engine
+	engine.initOptions.SimHashDistance = 3
+	engine.initSimHashes()
+	utils.Expect(t, "[4660 0 0 43981]", engine.simHashBands(0xabcd<<48|0x1234))
+}
+
+func TestNearDuplicates(t *testing.T) {
+	var engine Engine
+	engine.initOptions.SimHashDistance = 3
+	engine.initialized = true
+	engine.initDocOrdinals([]uint64{0})
+	engine.initDocKeys()
+	engine.initSimHashes()
+
+	const base uint64 = 0x0123456789abcdef
+	fingerprints := map[uint64]uint64{
+		1: base,
+		// 3 位不同，分在 3 个段中，第 4 段相同
+		2: base ^ (1 | 1<<20 | 1<<40),
+		// 4 位不同，各段都不同，不会被找到
+		3: base ^ (1 | 1<<20 | 1<<40 | 1<<60),
+		// 4 位不同，都在第 1 段中，能通过其他段找到但超过距离
+		4: base ^ 0xf,
+		// 1 位不同
+		5: base ^ 1<<63,
+	}
+	for docId := uint64(1); docId <= 5; docId++ {
+		engine.addSimHash(engine.ordinalOf(docId), fingerprints[docId])
+	}
+	utils.Expect(t, "[{5  1} {2  3}]", engine.NearDuplicates(1))
+	utils.Expect(t, "[]", engine.NearDuplicates(4))
+
+	// 替换文档的指纹后原来的段索引被删除
+	engine.addSimHash(engine.ordinalOf(5), ^base)
+	utils.Expect(t, "[{2  3}]", engine.NearDuplicates(1))
+
+	// 保留排在前面的文档，没有指纹的文档总是保留
+	docs := core.PairList{{Key: 3, Value: 5}, {Key: 1, Value: 4}, {Key: 6, Value: 3}, {Key: 2, Value: 2}, {Key: 4, Value: 1}}
+	utils.Expect(t, "[{3 5} {1 4} {6 3} {4 1}]", engine.collapseNearDuplicates(docs))
+}
@@ -12,7 +12,10 @@ import (
 	"octopus/types"
 	"os"
 	"runtime"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 )
 
@@ -28,6 +31,7 @@ type Engine struct {
 	numForceUpdatingRequests uint32
 	numTokenIndexAdded       uint32
 	numDocumentsStored       uint32
+	numStoringRequests       uint32
 	// 记录初始化参数
 	initOptions EngineInitOptions
 	initialized bool
@@ -36,6 +40,15 @@ type Engine struct {
 	indexers []core.Indexer
 
 	dbs []storage.Storage
+
+	// 分词器和同义词表，重新加载词典时整体替换
+	segmenterLock struct {
+		sync.RWMutex
+		jieba     *gojieba.Jieba
+		userWords map[string]bool
+		synonyms  map[string][]string
+	}
+
 	//建立分词器通道
 	segmenterChannel chan SegmenterRequest
 
@@ -45,6 +58,63 @@ type Engine struct {
 	// 建立持久存储使用的通信通道
 	persistentStorageIndexDocumentChannels []chan persistentStorageIndexDocumentRequest
 	persistentStorageInitChannel           chan bool
+
+	// 当前检查点之后写入持久存储的文档记录在日志中，见 checkpoint.go
+	journalLock struct {
+		sync.RWMutex
+		checkpoint uint64
+		journals   []storage.Storage
+	}
+	checkpointLock sync.Mutex
+
+	// 每个文档所在的索引器 shard 和最后处理的版本，以文档序号为键，见 doc_shards.go
+	docShards struct {
+		sync.Mutex
+		shards  map[uint32]documentShard
+		version uint64
+	}
+
+	// 字符串 ID 和 DocId 的映射，见 doc_keys.go
+	docKeys struct {
+		sync.RWMutex
+		docIds map[string]uint64
+		keys   map[uint64]string
+		next   uint64
+		db     storage.Storage
+		// 已分配但尚未写入持久存储的字符串 ID
+		pending []string
+		// 串行写入 pending，写入完成前其他协程不能开始写入引用这些 DocId 的文档
+		flushLock sync.Mutex
+	}
+
+	// 已加入文档的指纹，见 EngineInitOptions.SkipUnchangedDocuments
+	contentHashes struct {
+		sync.Mutex
+		hashes map[uint64]uint64
+	}
+
+	// 文档的 SimHash 指纹和按段分组的索引，见 duplicates.go
+	simHashes struct {
+		sync.RWMutex
+		fingerprints map[uint32]uint64
+		bands        []map[uint64][]uint32
+	}
+
+	// 纠错词表，按删除变体和全拼索引，见 spelling.go
+	spelling struct {
+		sync.RWMutex
+		words     []string
+		ids       map[string]uint32
+		deletions map[string][]uint32
+		pinyin    map[string][]uint32
+	}
+
+	// DocId 和索引器内部文档序号的映射，见 doc_ordinals.go
+	docOrdinals struct {
+		sync.RWMutex
+		ordinals map[uint64]uint32
+		docIds   []uint64
+	}
 }
 
 func (engine *Engine) Init(options EngineInitOptions) {
@@ -57,6 +127,12 @@ func (engine *Engine) Init(options EngineInitOptions) {
 	options.Init()
 	engine.initOptions = options
 	engine.initialized = true
+	engine.docShards.shards = make(map[uint32]documentShard)
+	engine.initDocOrdinals([]uint64{0})
+	engine.initDocKeys()
+	engine.contentHashes.hashes = make(map[uint64]uint64)
+	engine.initSimHashes()
+	engine.initSpelling()
 	// 初始化持久化存储通道
 	if engine.initOptions.UsePersistentStorage {
 		engine.persistentStorageIndexDocumentChannels =
@@ -64,11 +140,14 @@ func (engine *Engine) Init(options EngineInitOptions) {
 				engine.initOptions.PersistentStorageShards)
 		for shard := 0; shard < engine.initOptions.PersistentStorageShards; shard++ {
 			engine.persistentStorageIndexDocumentChannels[shard] = make(
-				chan persistentStorageIndexDocumentRequest)
+				chan persistentStorageIndexDocumentRequest, persistentStorageBatchSize)
 		}
 		engine.persistentStorageInitChannel = make(
 			chan bool, engine.initOptions.PersistentStorageShards)
 	}
+	// 初始化分词器
+	engine.initSegmenter()
+
 	// 初始化分词器通道
 	engine.segmenterChannel = make(
 		chan SegmenterRequest, options.NumSegmenterThreads)
@@ -79,11 +158,13 @@ func (engine *Engine) Init(options EngineInitOptions) {
 	}
 	fmt.Println("SegmenterWorker start")
 
-	// 初始化索引器
+	// 初始化索引器，内部索引项不计入关键词统计
+	indexerOptions := *options.IndexerInitOptions
+	indexerOptions.InternalKeywordPrefixes = internalKeywordPrefixes
 	var i uint32
 	for i = 0; i < options.NumShards; i++ {
 		engine.indexers = append(engine.indexers, core.Indexer{})
-		engine.indexers[i].Init(*options.IndexerInitOptions)
+		engine.indexers[i].Init(indexerOptions)
 	}
 	// 初始化索引器通道
 	engine.indexerAddDocChannels = make(
@@ -121,9 +202,23 @@ func (engine *Engine) Init(options EngineInitOptions) {
 			engine.dbs[shard] = db
 		}
 
-		// 从数据库中恢复
+		engine.openDocKeys()
+
+		// 从数据库中恢复，有检查点时只重新索引检查点之后写入的文档
+		checkpoint, loaded := engine.loadCheckpoint()
+		if loaded {
+			engine.initDocumentShards()
+			engine.initSpellingFromIndex()
+			if engine.initOptions.DetectNearDuplicates {
+				engine.initSimHashesFromIndex()
+			}
+		}
 		for shard := 0; shard < engine.initOptions.PersistentStorageShards; shard++ {
-			go engine.persistentStorageInitWorker(shard)
+			if loaded {
+				go engine.persistentStorageReplayWorker(shard, checkpoint)
+			} else {
+				go engine.persistentStorageInitWorker(shard)
+			}
 		}
 
 		// 等待恢复完成
@@ -132,7 +227,8 @@ func (engine *Engine) Init(options EngineInitOptions) {
 		}
 		for {
 			runtime.Gosched()
-			if engine.numIndexingRequests == engine.numDocumentsIndexed {
+			if engine.numIndexingRequests == engine.numDocumentsIndexed &&
+				engine.numRemovingRequests == engine.numDocumentsRemoved {
 				break
 			}
 		}
@@ -147,6 +243,7 @@ func (engine *Engine) Init(options EngineInitOptions) {
 			}
 			engine.dbs[shard] = db
 		}
+		engine.initJournals(checkpoint)
 
 		for shard := 0; shard < engine.initOptions.PersistentStorageShards; shard++ {
 			go engine.persistentStorageIndexDocumentWorker(shard)
@@ -156,34 +253,104 @@ func (engine *Engine) Init(options EngineInitOptions) {
 
 // 将文档加入索引
 // 输入参数：
-//  docId	      标识文档编号，必须唯一，docId == 0 表示非法文档（用于强制刷新索引），[1, +oo) 表示合法文档
+//  docId	      标识文档编号，必须唯一，docId == 0 表示非法文档（用于强制刷新索引），[1, MaxDocId] 表示合法文档
 //  data	      见DocumentIndexData注释
 //  forceUpdate 是否强制刷新 cache，如果设为 true，则尽快添加到索引，否则等待 cache 满之后一次全量添加
 
 func (engine *Engine) IndexDocument(docId uint64, data types.DocumentIndexData, forceUpdate bool) {
-	engine.internalIndexDocument(docId, data, forceUpdate)
+	if docId > MaxDocId {
+		// 更大的 DocId 已分配给字符串 ID，加入后会覆盖对应的文档
+		fmt.Println("DocId 超过 MaxDocId，忽略文档:", docId)
+		if forceUpdate {
+			engine.internalIndexDocument(0, types.DocumentIndexData{}, true, false)
+		}
+		return
+	}
+	engine.indexDocument(docId, data, forceUpdate)
+}
+
+// 加入文档并写入持久存储，docId 可以是为字符串 ID 分配的 DocId
+func (engine *Engine) indexDocument(docId uint64, data types.DocumentIndexData, forceUpdate bool) {
+	// 内容和上次加入时相同的文档不必重新索引和写入持久存储
+	if !engine.internalIndexDocument(docId, data, forceUpdate, engine.initOptions.SkipUnchangedDocuments) {
+		if forceUpdate {
+			engine.internalIndexDocument(0, types.DocumentIndexData{}, true, false)
+		}
+		return
+	}
 
-	hash := murmur.Murmur3([]byte(fmt.Sprint("%d", docId))) % uint32(engine.initOptions.PersistentStorageShards)
 	if engine.initOptions.UsePersistentStorage && docId != 0 {
+		hash := engine.persistentStorageShard(docId)
+		atomic.AddUint32(&engine.numStoringRequests, 1)
 		engine.persistentStorageIndexDocumentChannels[hash] <- persistentStorageIndexDocumentRequest{docId: docId, data: data}
 	}
 }
 
+// 将文档从索引和持久存储中删除
+// 文档在各 shard 中只被标记为删除，查找时立即过滤，倒排表在后台合并时清理
+// 删除前加入、尚未完成分词的同一文档处理完后被丢弃，不会再出现在索引中
+func (engine *Engine) RemoveDocument(docId uint64) {
+	engine.internalRemoveDocument(docId)
+
+	if engine.initOptions.UsePersistentStorage && docId != 0 {
+		engine.persistentStorageRemoveDocumentWorker(docId, engine.persistentStorageShard(docId))
+	}
+}
+
+func (engine *Engine) internalRemoveDocument(docId uint64) {
+	if !engine.initialized {
+		log.Fatal("必须先初始化引擎")
+	}
+	version := engine.forgetContentHash(docId)
+	ordinal, found := engine.lookupOrdinal(docId)
+	if !found {
+		return
+	}
+	// 还在分词的旧版本处理完后被丢弃，只需从文档当前所在的 shard 中删除
+	engine.removeFromShards(ordinal, version)
+}
+
+// 从一个 shard 中删除文档，numRemovingRequests 按 shard 计数
+func (engine *Engine) removeFromShard(shard uint32, docId uint32) {
+	atomic.AddUint32(&engine.numRemovingRequests, 1)
+	engine.indexerAddDocChannels[shard] <- IndexerAddDocumentRequest{removeDocId: docId}
+}
+
+// 文档内容的哈希值，由 getShard 决定文档所在的索引器 shard
+// 拼接出的字节沿用早期版本的 fmt.Sprint("%d%s", docId, content)，改变后检查点中文档所在的 shard 会对不上
+func (engine *Engine) documentHash(docId uint64, content string) uint32 {
+	return murmur.Murmur3([]byte("%d%s" + strconv.FormatUint(docId, 10) + content))
+}
+
+// 文档所在的持久存储 shard
+// 和早期版本 fmt.Sprint("%d", docId) 的结果相同，保证已有的数据库仍然可用
+func (engine *Engine) persistentStorageShard(docId uint64) uint32 {
+	key := "%d" + strconv.FormatUint(docId, 10)
+	return murmur.Murmur3([]byte(key)) % uint32(engine.initOptions.PersistentStorageShards)
+}
+
+// 把文档送入分词器，skipUnchanged 为 true 且文档内容和上次加入时相同时不做任何事并返回 false
 func (engine *Engine) internalIndexDocument(
-	docId uint64, data types.DocumentIndexData, forceUpdate bool) {
+	docId uint64, data types.DocumentIndexData, forceUpdate bool, skipUnchanged bool) bool {
 	if !engine.initialized {
 		log.Fatal("必须先初始化引擎")
 	}
 
+	var version uint64
 	if docId != 0 {
+		var changed bool
+		if version, changed = engine.recordContentHash(docId, data, skipUnchanged); !changed {
+			return false
+		}
 		atomic.AddUint32(&engine.numIndexingRequests, 1)
 	}
 	if forceUpdate {
 		atomic.AddUint32(&engine.numForceUpdatingRequests, 1)
 	}
-	hash := murmur.Murmur3([]byte(fmt.Sprint("%d%s", docId, data.Content)))
+	hash := engine.documentHash(docId, data.Content)
 	engine.segmenterChannel <- SegmenterRequest{
-		DocId: uint32(docId), Hash: hash, Data: data, ForceUpdate: forceUpdate}
+		DocId: docId, Ordinal: engine.ordinalOf(docId), Version: version, Hash: hash, Data: data, ForceUpdate: forceUpdate}
+	return true
 }
 
 //从mysql获取文档加入索引
@@ -214,9 +381,10 @@ func (engine *Engine) IndexBulkDocumentFromMysql(mysql_ip string, mysql_port str
 			err = rows.Scan(&id, &pid, &title, &content, &createtime, &updatetime)
 			data := types.DocumentIndexData{PostId: pid, Title: title, Content: content,
 				CreateTime: createtime, UpdateTime: updatetime}
-			hash := murmur.Murmur3([]byte(fmt.Sprint("%d %s", id, data.Content)))
+			hash := murmur.Murmur3([]byte("%d %s" + strconv.FormatUint(uint64(id), 10) + data.Content))
 			engine.segmenterChannel <- SegmenterRequest{
-				DocId: id, Hash: hash, Data: data, ForceUpdate: false}
+				DocId: uint64(id), Ordinal: engine.ordinalOf(uint64(id)), Version: engine.nextDocumentVersion(),
+				Hash: hash, Data: data, ForceUpdate: false}
 			flag = true
 			start +=1
 			if start%100==0 {
@@ -243,35 +411,269 @@ func (engine *Engine) getShard(hash uint32) uint32 {
 }
 
 // 查找满足搜索条件的文档，此函数线程安全
-func (engine *Engine) Search(request types.SearchRequest) (docs core.PairList) {
+func (engine *Engine) Search(request types.SearchRequest) (output types.SearchResponse) {
 	if !engine.initialized {
 		log.Fatal("必须先初始化引擎")
 	}
 	//提取检索词
-	words := gojieba.NewJieba().CutForSearch(request.Text, true)
-	if len(words) != 0 {
-		//搜索对应关键词
-		docs = engine.indexers[0].Lookup(words)
+	text := engine.initOptions.Normalization.normalize(request.Text)
+	var entities []string
+	rest := text
+	if engine.initOptions.ExtractEntities {
+		entities, rest = extractEntities(text)
+	}
+	var words []string
+	for _, word := range engine.cutForSearch(rest) {
+		if strings.TrimSpace(word) != "" {
+			words = append(words, word)
+		}
+	}
+	if len(words) == 0 && len(entities) == 0 && len(request.Labels) == 0 && len(request.FieldRanges) == 0 {
+		fmt.Println("请输入有效检索词！")
 		return
+	}
+	output.Tokens = make([]string, len(words))
+	for i, word := range words {
+		output.Tokens[i] = engine.stemKeyword(word)
+	}
+	//实体和标签不经过分词，不做扩展，标签只用来过滤文档，不参与打分
+	labels := make([]string, len(request.Labels))
+	for i, label := range request.Labels {
+		labels[i] = engine.initOptions.Normalization.normalize(label)
+	}
+	filters := engine.searchFilters(labels, request.DocIds, request.FieldRanges)
+
+	//同义词扩展
+	groups, expansions := engine.expandSynonyms(output.Tokens)
+	output.Expansions = expansions
+	if engine.initOptions.UsePinyinIndex {
+		engine.expandPinyin(words, groups)
+	}
+	for _, entity := range entities {
+		groups = append(groups, []types.QueryToken{{Word: entity, Weight: 1}})
+	}
+	// 纠错建议只针对分词得到的检索词，实体和标签不在词表中
+	segmentedTokens := output.Tokens
+	output.Tokens = append(output.Tokens, entities...)
+	output.Tokens = append(output.Tokens, labels...)
+	if engine.initOptions.UseGlobalIDF {
+		engine.weightByIDF(groups)
+	}
+
+	//搜索对应关键词并排序
+	rankOptions := request.RankOptions
+	if rankOptions == nil {
+		rankOptions = &types.RankOptions{}
+	}
+	var docs core.PairList
+	var numDocs int
+	if len(groups) == 0 {
+		docs = filteredDocuments(filters)
+		numDocs = len(docs)
+	} else if rankOptions.MaxOutputs > 0 && !rankOptions.ReverseOrder && rankOptions.SortByField == "" &&
+		!rankOptions.CollapseNearDuplicates {
+		k := int(rankOptions.OutputOffset + rankOptions.MaxOutputs)
+		docs = engine.lookupTopK(groups, k, filters)
+		numDocs = len(docs)
+		if numDocs == k {
+			// 前 k 名之后可能还有文档，只统计个数，不计算得分
+			numDocs = engine.count(groups, filters)
+		}
 	} else {
-		fmt.Println("请输入有效检索词！")
+		docs = engine.lookup(groups, filters)
+		numDocs = len(docs)
 	}
+	if engine.initOptions.UseBigramIndex && numDocs < engine.initOptions.MinWordLevelResults {
+		//词语级别的结果太少时用二元组索引补充，此时文档很少，先取得被前 k 名截断的全部文档
+		if numDocs > len(docs) {
+			docs = engine.lookup(groups, filters)
+		}
+		docs = engine.appendBigramResults(text, docs, filters)
+		numDocs = len(docs)
+	}
+	if len(docs) == 0 {
+		//没有结果时给出纠错建议
+		output.Suggestions = engine.spellingSuggestions(segmentedTokens)
+	}
+	if rankOptions.SortByField != "" {
+		engine.sortByField(docs, rankOptions.SortByField, rankOptions.ReverseOrder)
+	}
+	if rankOptions.CollapseNearDuplicates {
+		// 折叠时不使用前 k 名查找，docs 是全部文档，被折叠的文档不计入文档数
+		docs = engine.collapseNearDuplicates(docs)
+		numDocs = len(docs)
+	}
+	output.NumDocs = numDocs
+	if rankOptions.ReverseOrder && rankOptions.SortByField == "" {
+		for i, j := 0, len(docs)-1; i < j; i, j = i+1, j-1 {
+			docs[i], docs[j] = docs[j], docs[i]
+		}
+	}
+	if int(rankOptions.OutputOffset) >= len(docs) {
+		docs = nil
+	} else if rankOptions.OutputOffset > 0 {
+		docs = docs[rankOptions.OutputOffset:]
+	}
+	if rankOptions.MaxOutputs > 0 && int(rankOptions.MaxOutputs) < len(docs) {
+		docs = docs[:rankOptions.MaxOutputs]
+	}
+	output.Docs = make([]types.ScoredDocument, len(docs))
+	for i, doc := range docs {
+		docId := engine.docIdOf(doc.Key)
+		output.Docs[i] = types.ScoredDocument{DocId: docId, Key: engine.keyOfDocId(docId), Scores: []float32{doc.Value}}
+	}
+	return
+}
+
+// 各 shard 中带有全部标签、在 docIds 之中且字段值都在范围内的文档，没有对应的条件时不限制
+// 都没有时返回的各 shard 过滤条件均为 nil，即不过滤
+func (engine *Engine) searchFilters(labels []string, docIds []uint64, ranges []types.FieldRange) []*core.Bitmap {
+	filters := make([]*core.Bitmap, len(engine.indexers))
+	var requested *core.Bitmap
+	if len(docIds) > 0 {
+		requested = core.NewBitmap()
+		for _, docId := range docIds {
+			if ordinal, found := engine.lookupOrdinal(docId); found {
+				requested.Add(ordinal)
+			}
+		}
+	}
+	for shard := range engine.indexers {
+		indexer := &engine.indexers[shard]
+		filters[shard] = andFilter(indexer.KeywordBitmap(labels), requested)
+		for _, r := range ranges {
+			filters[shard] = andFilter(filters[shard], indexer.FieldRangeBitmap(r.Field, r.Min, r.Max))
+		}
+	}
+	return filters
+}
+
+// 两个过滤条件的交集，nil 表示不过滤
+func andFilter(a, b *core.Bitmap) *core.Bitmap {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	return core.And(a, b)
+}
+
+// 按数值字段从大到小（ascending 为 true 时从小到大）稳定排序，字段值相同时保持按得分从大到小排列的顺序
+// 每个文档只在一个 shard 中，从各 shard 取得各自文档的字段值，没有该字段的文档排在最后
+func (engine *Engine) sortByField(docs core.PairList, field string, ascending bool) {
+	docIds := make([]uint32, len(docs))
+	for i, doc := range docs {
+		docIds[i] = doc.Key
+	}
+	values := make(map[uint32]int64, len(docs))
+	for shard := range engine.indexers {
+		for docId, value := range engine.indexers[shard].FieldValues(field, docIds) {
+			values[docId] = value
+		}
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		a, foundA := values[docs[i].Key]
+		b, foundB := values[docs[j].Key]
+		if foundA != foundB {
+			return foundA
+		}
+		if ascending {
+			return a < b
+		}
+		return a > b
+	})
+}
+
+// 只有标签等过滤条件时返回满足条件的全部文档，得分均为 0
+func filteredDocuments(filters []*core.Bitmap) (docs core.PairList) {
+	for _, filter := range filters {
+		filter.ForEach(func(docId uint32) {
+			docs = append(docs, core.Pair{Key: docId})
+		})
+	}
+	return
+}
+
+// 在全部 shard 中查找满足检索词组和过滤条件的文档，按得分排序
+func (engine *Engine) lookup(groups [][]types.QueryToken, filters []*core.Bitmap) (docs core.PairList) {
+	for shard := range engine.indexers {
+		docs = append(docs, engine.indexers[shard].LookupGroups(groups, filters[shard])...)
+	}
+	sort.Stable(docs)
+	return
+}
+
+// 全部 shard 中满足全部检索词组的文档数
+func (engine *Engine) count(groups [][]types.QueryToken, filters []*core.Bitmap) (numDocs int) {
+	for shard := range engine.indexers {
+		numDocs += engine.indexers[shard].CountGroups(groups, filters[shard])
+	}
+	return
+}
 
-	//排序
+// 在全部 shard 中查找得分最高的 k 个文档，按得分排序
+// 每个 shard 的文档互不重叠，各 shard 的前 k 名合并后再取前 k 名
+func (engine *Engine) lookupTopK(groups [][]types.QueryToken, k int, filters []*core.Bitmap) (docs core.PairList) {
+	for shard := range engine.indexers {
+		docs = append(docs, engine.indexers[shard].LookupTopK(groups, k, filters[shard])...)
+	}
+	sort.Stable(docs)
+	if len(docs) > k {
+		docs = docs[:k]
+	}
 	return
 }
 
 // 阻塞等待直到所有索引添加完毕
 func (engine *Engine) FlushIndex() {
+	for {
+		runtime.Gosched()
+		if atomic.LoadUint32(&engine.numIndexingRequests) == atomic.LoadUint32(&engine.numDocumentsIndexed) {
+			// 保证通道中的请求全部被执行完
+			break
+		}
+	}
+	for {
+		runtime.Gosched()
+		if atomic.LoadUint32(&engine.numRemovingRequests) == atomic.LoadUint32(&engine.numDocumentsRemoved) {
+			break
+		}
+	}
+	// 强制更新，保证其为最后的请求
 	engine.IndexDocument(0, types.DocumentIndexData{}, true)
+	for {
+		runtime.Gosched()
+		if atomic.LoadUint32(&engine.numForceUpdatingRequests)*engine.initOptions.NumShards ==
+			atomic.LoadUint32(&engine.numDocumentsForceUpdated) {
+			return
+		}
+	}
 }
 
-// 关闭引擎
+// 关闭引擎，启用持久存储时保存检查点后关闭数据库，之后不能再加入或删除文档
 func (engine *Engine) Close() {
 	engine.FlushIndex()
-	//if engine.initOptions.UsePersistentStorage {
-	//	for _, db := range engine.dbs {
-	//		db.Close()
-	//	}
-	//}
+	if engine.initOptions.UsePersistentStorage {
+		// 等待持久存储写入完毕
+		for atomic.LoadUint32(&engine.numStoringRequests) != atomic.LoadUint32(&engine.numDocumentsStored) {
+			runtime.Gosched()
+		}
+		if err := engine.Checkpoint(); err != nil {
+			fmt.Println("无法保存检查点:", err)
+		}
+	}
+	if engine.initOptions.UsePersistentStorage {
+		for _, db := range engine.dbs {
+			db.Close()
+		}
+		engine.journalLock.Lock()
+		for _, journal := range engine.journalLock.journals {
+			journal.Close()
+		}
+		engine.journalLock.Unlock()
+		engine.docKeys.Lock()
+		engine.docKeys.db.Close()
+		engine.docKeys.Unlock()
+	}
 }
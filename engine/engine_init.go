@@ -5,6 +5,30 @@ import (
 	"runtime"
 )
 
+// 这些常数定义了分词器从文本中提取关键词的方式
+const (
+	// 按 TF-IDF 提取权重最高的 KeywordTopK 个关键词，权重除以最大权重
+	TFIDFExtraction = iota
+
+	// 保留全部分词结果，权重为词频
+	TermFrequencyExtraction
+
+	// 按 TextRank 提取得分最高的 KeywordTopK 个关键词，权重除以最大得分
+	TextRankExtraction
+)
+
+// 这些常数定义了正文的格式，分词前会去掉相应的标记
+const (
+	// 纯文本，不做处理
+	PlainTextContent = iota
+
+	// HTML，去掉标签、脚本和样式，解码实体
+	HTMLContent
+
+	// Markdown，去掉标记，保留链接和图片的文字
+	MarkdownContent
+)
+
 var (
 	// EngineInitOptions的默认值
 	NumCPU = runtime.NumCPU()
@@ -17,6 +41,13 @@ var (
 	defaultNumRankerThreadsPerShard         = numThread
 	defaultPersistentStorageShards          = 1
 	defaultIndexerInitOptions               = core.IndexerInitOptions{}
+	defaultKeywordTopK                      = 1000
+	defaultSynonymWeight            float32 = 0.8
+	defaultPinyinWeight             float32 = 0.6
+	defaultMinWordLevelResults              = 10
+	defaultBigramWeight             float32 = 0.3
+	defaultMaxSuggestions                   = 5
+	defaultSimHashDistance                  = 3
 )
 
 type EngineInitOptions struct {
@@ -41,10 +72,83 @@ type EngineInitOptions struct {
 	// 索引器初始化选项
 	IndexerInitOptions *core.IndexerInitOptions
 
+	// 正文的格式，见 PlainTextContent 等常数
+	ContentFormat int
+
+	// 去掉正文标记时是否同时去掉代码块
+	SkipCodeBlocks bool
+
+	// 是否在分词前提取网址、邮件地址、IP 地址、@提及、#话题# 和版本号，作为完整的关键词索引
+	ExtractEntities bool
+
+	// 关键词提取方式，见 TFIDFExtraction 等常数
+	// 正文为空时从标题提取关键词
+	KeywordExtraction int
+
+	// TF-IDF 和 TextRank 方式下每篇文档最多保留的关键词数
+	KeywordTopK int
+
+	// 用户词典文件列表，每行格式为 "词语 [词频] [词性]"
+	// 可以在引擎运行时修改文件后调用 ReloadDictionary 重新加载
+	UserDictionaryFiles []string
+
+	// 分词前的文本归一化选项
+	Normalization NormalizationOptions
+
+	// 是否把由拉丁字母组成的关键词转换为小写并提取英文词干
+	// 开启后 "goroutine" 可以匹配 "Goroutines"，汉字部分仍由结巴分词处理
+	StemEnglishWords bool
+
+	// 同义词文件列表，每行一组用逗号分隔的同义词，例如 "男朋友, 男友, bf"
+	// 搜索时关键词会被扩展为包含其同义词的 OR 组，不需要重建索引
+	SynonymFiles []string
+
+	// 同义词命中时得分的系数，原始关键词的系数为 1
+	SynonymWeight float32
+
+	// 是否为正文中的汉字关键词建立全拼和拼音首字母索引
+	// 开启后搜索 "nanpengyou" 或 "npy" 可以找到包含 "男朋友" 的文档
+	UsePinyinIndex bool
+
+	// 拼音命中时得分的系数，应小于 1 以保证直接命中的文档排在前面
+	// 首字母命中时系数减半
+	PinyinWeight float32
+
+	// 是否为正文建立相邻两字的二元组索引，用于查找分词器不会切出的片段，例如用户名的一部分
+	UseBigramIndex bool
+
+	// 词语级别的搜索结果少于此数时用二元组索引补充结果
+	MinWordLevelResults int
+
+	// 二元组命中时得分的系数
+	BigramWeight float32
+
+	// 搜索结果为空时每个关键词最多给出的纠错建议数
+	MaxSuggestions int
+
+	// 文档内容和上次加入时相同时是否跳过重新索引，标题、正文和数值字段都相同才视为不变
+	// 指纹只保存在内存中，重启后每个文档第一次重新加入时仍会被索引
+	SkipUnchangedDocuments bool
+
+	// 是否为文档计算 SimHash 指纹，用于发现转载等近似重复的文档，见 Engine.NearDuplicates
+	DetectNearDuplicates bool
+
+	// SimHash 指纹的汉明距离不超过此数的文档视为近似重复
+	SimHashDistance int
+
+	// 搜索时是否用全部 shard 合计的逆文档频率给检索词加权，罕见词命中的文档得分更高
+	// 文档数和文档频率都是全局值，文档的得分和它所在的 shard 无关
+	UseGlobalIDF bool
+
 	// 是否使用持久数据库，以及数据库文件保存的目录和裂分数目
 	UsePersistentStorage    bool
 	PersistentStorageFolder string
 	PersistentStorageShards int
+
+	// 离线建立索引时设为 true，见 indexbuilder，只能用于空的持久存储目录
+	// 写入持久存储的文档不记录在日志中，加入全部文档后调用 Close 保存检查点
+	// 保存检查点之前进程退出时目录中没有检查点，重启后从持久存储重建索引
+	BulkLoad bool
 }
 
 // 初始化EngineInitOptions，当用户未设定某个选项的值时用默认值取代
@@ -78,6 +182,34 @@ func (options *EngineInitOptions) Init() {
 		options.NumRankerThreadsPerShard = defaultNumRankerThreadsPerShard
 	}
 
+	if options.KeywordTopK == 0 {
+		options.KeywordTopK = defaultKeywordTopK
+	}
+
+	if options.SynonymWeight == 0 {
+		options.SynonymWeight = defaultSynonymWeight
+	}
+
+	if options.PinyinWeight == 0 {
+		options.PinyinWeight = defaultPinyinWeight
+	}
+
+	if options.MinWordLevelResults == 0 {
+		options.MinWordLevelResults = defaultMinWordLevelResults
+	}
+
+	if options.BigramWeight == 0 {
+		options.BigramWeight = defaultBigramWeight
+	}
+
+	if options.MaxSuggestions == 0 {
+		options.MaxSuggestions = defaultMaxSuggestions
+	}
+
+	if options.SimHashDistance == 0 {
+		options.SimHashDistance = defaultSimHashDistance
+	}
+
 	if options.PersistentStorageShards == 0 {
 		options.PersistentStorageShards = defaultPersistentStorageShards
 	}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"regexp"
+	"strings"
+)
+
+// 分词器会把这些特殊实体切成没有意义的碎片，因此在分词前把它们整体提取出来
+var (
+	// 网址，到空白、引号、尖括号或中文字符为止
+	urlPattern = regexp.MustCompile(`(?i)(?:https?|ftp)://[^\s<>"'\p{Han}，。！？、；：（）【】]+`)
+
+	// 电子邮件地址，需在 @提及之前提取
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`)
+
+	// IPv4 地址，需在版本号之前提取
+	ipPattern = regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b`)
+
+	// 微博风格的 #话题# 和推特风格的 #hashtag
+	hashtagPattern = regexp.MustCompile(`#[^#\s]{1,50}#|#[\p{L}\p{N}_]+`)
+
+	// @提及，@ 前是开头或不能出现在邮件地址中的字符，匹配结果包括这个字符
+	mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9._%+\-])@[\p{L}\p{N}_\-]+`)
+
+	// 可能是版本号的数字，由 isVersion 排除小数和日期
+	versionPattern = regexp.MustCompile(`\b[vV]?\d+(?:\.\d+)+\b`)
+
+	// 日期中的年份
+	yearPattern = regexp.MustCompile(`^(?:19|20)\d\d$`)
+)
+
+// 带 v 前缀的 v1.2 或至少有三段的 1.2.3 是版本号，3.14 等小数和 2019.10.1、1.10.2019 等日期不是
+func isVersion(text string) bool {
+	if text[0] == 'v' || text[0] == 'V' {
+		return true
+	}
+	parts := strings.Split(text, ".")
+	return len(parts) >= 3 && !yearPattern.MatchString(parts[0]) && !yearPattern.MatchString(parts[len(parts)-1])
+}
+
+// 网址末尾常常紧跟着句末标点，这些标点不属于网址
+const urlTrailingPunctuation = ".,;:!?)]}'\""
+
+// 从文本中提取网址、邮件地址、IP 地址、话题、@提及和版本号，返回提取出的实体和去掉实体后的文本
+// 话题和@提及中的文字仍保留在返回的文本中，因此不带符号也能搜索到
+func extractEntities(text string) (entities []string, rest string) {
+	text = urlPattern.ReplaceAllStringFunc(text, func(url string) string {
+		trimmed := strings.TrimRight(url, urlTrailingPunctuation)
+		entities = append(entities, trimmed)
+		return " " + url[len(trimmed):]
+	})
+	for _, pattern := range []*regexp.Regexp{emailPattern, ipPattern} {
+		text = pattern.ReplaceAllStringFunc(text, func(entity string) string {
+			entities = append(entities, entity)
+			return " "
+		})
+	}
+	text = hashtagPattern.ReplaceAllStringFunc(text, func(hashtag string) string {
+		entities = append(entities, hashtag)
+		return " " + strings.Trim(hashtag, "#") + " "
+	})
+	text = mentionPattern.ReplaceAllStringFunc(text, func(mention string) string {
+		at := strings.IndexByte(mention, '@')
+		entities = append(entities, mention[at:])
+		return mention[:at] + " " + mention[at+1:] + " "
+	})
+	text = versionPattern.ReplaceAllStringFunc(text, func(version string) string {
+		if !isVersion(version) {
+			return version
+		}
+		entities = append(entities, version)
+		return " "
+	})
+	return entities, text
+}
+
+// 把实体作为完整的关键词加入 tokensMap
+// 按词频提取关键词时权重为出现次数，否则为最大权重 1
+func (engine *Engine) addEntityKeywords(tokensMap map[string]float32, entities []string) {
+	for _, entity := range entities {
+		if engine.initOptions.KeywordExtraction == TermFrequencyExtraction {
+			tokensMap[entity]++
+		} else {
+			tokensMap[entity] = 1
+		}
+	}
+}
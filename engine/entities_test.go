@@ -0,0 +1,34 @@
+package engine
+
+import (
+	"github.com/huichen/wukong/utils"
+	"testing"
+)
+
+func TestExtractEntities(t *testing.T) {
+	entities, rest := extractEntities("详见 https://example.com/a?b=1。感谢@张三 和 @li_si")
+	utils.Expect(t, "[https://example.com/a?b=1 @张三 @li_si]", entities)
+	utils.Expect(t, "详见  。感谢 张三  和  li_si ", rest)
+
+	// 邮件地址不是 @提及
+	entities, rest = extractEntities("联系admin@example.com，抄送 a.b+c@mail.example.org")
+	utils.Expect(t, "[admin@example.com a.b+c@mail.example.org]", entities)
+	utils.Expect(t, "联系 ，抄送  ", rest)
+
+	// IP 地址不是版本号
+	entities, rest = extractEntities("服务器 192.168.1.1 升级到 v1.2.3，圆周率 3.14")
+	utils.Expect(t, "[192.168.1.1 v1.2.3]", entities)
+	utils.Expect(t, "服务器   升级到  ，圆周率 3.14", rest)
+
+	// 小数和日期不是版本号
+	for _, text := range []string{"3.14", "0.5", "2019.10.1", "2020.1.15", "1.10.2019", "12.5"} {
+		entities, rest = extractEntities(text)
+		utils.Expect(t, "[[] "+text+"]", []interface{}{entities, rest})
+	}
+	entities, _ = extractEntities("Python 3.8.10 和 Go v1.21 以及 V2.0")
+	utils.Expect(t, "[3.8.10 v1.21 V2.0]", entities)
+
+	entities, rest = extractEntities("#恋爱话题# 和 #golang")
+	utils.Expect(t, "[#恋爱话题# #golang]", entities)
+	utils.Expect(t, " 恋爱话题  和  golang ", rest)
+}
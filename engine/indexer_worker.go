@@ -8,11 +8,19 @@ import (
 type IndexerAddDocumentRequest struct {
 	document    *types.DocumentIndex
 	forceUpdate bool
+
+	// 不为 0 时删除该文档，和加入文档在同一协程中处理
+	removeDocId uint32
 }
 
 func (engine *Engine) indexerAddDocumentWorker(shard uint32) {
 	for {
 		request := <-engine.indexerAddDocChannels[shard]
+		if request.removeDocId != 0 {
+			engine.indexers[shard].RemoveDocument(request.removeDocId)
+			atomic.AddUint32(&engine.numDocumentsRemoved, 1)
+			continue
+		}
 		engine.indexers[shard].AddDocumentToCache(request.document, request.forceUpdate)
 		if request.document != nil {
 			atomic.AddUint32(&engine.numTokenIndexAdded,
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"github.com/yanyiwu/gojieba"
+	"unicode"
+)
+
+// 从文本中提取关键词，返回关键词到权重的映射和文本的关键词长度
+// 提取方式由 KeywordExtraction 决定，文本为空或没有可索引的词时返回空映射
+func (engine *Engine) extractKeywords(text string) (tokensMap map[string]float32, numTokens int) {
+	tokensMap = make(map[string]float32)
+	if text == "" {
+		return
+	}
+
+	var keywords []gojieba.WordWeight
+	switch engine.initOptions.KeywordExtraction {
+	case TermFrequencyExtraction:
+		// 保留全部分词结果，权重为词频
+		for _, word := range engine.cut(text) {
+			if isIndexableWord(word) {
+				tokensMap[engine.stemKeyword(word)]++
+				numTokens++
+			}
+		}
+		return
+	case TextRankExtraction:
+		var words []string
+		for _, word := range engine.cut(text) {
+			if isIndexableWord(word) {
+				words = append(words, word)
+			}
+		}
+		keywords = textRank(words, engine.initOptions.KeywordTopK)
+		numTokens = len(words)
+	default:
+		keywords = engine.extractWithWeight(text, engine.initOptions.KeywordTopK)
+		numTokens = len(keywords)
+	}
+
+	// 权重按从大到小排列，用最大权重归一化
+	if len(keywords) == 0 || keywords[0].Weight <= 0 {
+		return
+	}
+	normal := keywords[0].Weight
+	for _, keyword := range keywords {
+		// 不同词形提取出相同词干时合并权重
+		tokensMap[engine.stemKeyword(keyword.Word)] += float32(keyword.Weight / normal)
+	}
+	return
+}
+
+// 判断分词结果是否值得索引，空白和纯标点符号不加入索引
+func isIndexableWord(word string) bool {
+	for _, r := range word {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
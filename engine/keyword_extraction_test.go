@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"github.com/huichen/wukong/utils"
+	"github.com/yanyiwu/gojieba"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// 口号出现次数最多，但只和少数几个词相邻；微服务和更多不同的词共现
+const keywordExtractionText = "口号 口号 口号 口号 微服务 架构 微服务 部署 微服务 监控 拆分。"
+
+// 按权重从大到小排列的关键词，权重相同时按字典序排列
+func rankedKeywords(tokensMap map[string]float32) []string {
+	words := make([]string, 0, len(tokensMap))
+	for word := range tokensMap {
+		words = append(words, word)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if tokensMap[words[i]] != tokensMap[words[j]] {
+			return tokensMap[words[i]] > tokensMap[words[j]]
+		}
+		return words[i] < words[j]
+	})
+	return words
+}
+
+func TestTextRank(t *testing.T) {
+	keywords := textRank(strings.Fields("口号 口号 口号 口号 微服务 架构 微服务 部署 微服务 监控 拆分 的"), 3)
+	words := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		words[i] = keyword.Word
+	}
+	// 单字词不是候选关键词
+	utils.Expect(t, "[微服务 口号 架构]", words)
+	utils.Expect(t, "0", len(textRank([]string{"的", "了"}, 3)))
+}
+
+func TestExtractKeywords(t *testing.T) {
+	var engine Engine
+	engine.segmenterLock.jieba = gojieba.NewJieba()
+	for _, word := range []string{"口号", "微服务", "架构", "部署", "监控", "拆分"} {
+		engine.segmenterLock.jieba.AddWord(word)
+	}
+	engine.initOptions.KeywordTopK = 3
+
+	// 按词频提取时保留全部词语，排名和出现次数一致
+	engine.initOptions.KeywordExtraction = TermFrequencyExtraction
+	tokensMap, numTokens := engine.extractKeywords(keywordExtractionText)
+	utils.Expect(t, "[[口号 微服务 拆分 架构 监控 部署] 11]", []interface{}{rankedKeywords(tokensMap), numTokens})
+	utils.Expect(t, "4", tokensMap["口号"])
+
+	// TextRank 把和更多词共现的微服务排在出现次数更多的口号之前
+	engine.initOptions.KeywordExtraction = TextRankExtraction
+	tokensMap, numTokens = engine.extractKeywords(keywordExtractionText)
+	utils.Expect(t, "[[微服务 口号 架构] 11]", []interface{}{rankedKeywords(tokensMap), numTokens})
+	utils.Expect(t, "1", tokensMap["微服务"])
+
+	// TF-IDF 的排名取决于分词器的 IDF 词典，这里只检查数量和归一化
+	engine.initOptions.KeywordExtraction = TFIDFExtraction
+	tokensMap, numTokens = engine.extractKeywords(keywordExtractionText)
+	ranked := rankedKeywords(tokensMap)
+	utils.Expect(t, "[3 3 1]", []interface{}{len(ranked), numTokens, tokensMap[ranked[0]]})
+
+	tokensMap, numTokens = engine.extractKeywords("")
+	utils.Expect(t, "[0 0]", []interface{}{len(tokensMap), numTokens})
+}
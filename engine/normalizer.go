@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"github.com/siongui/gojianfan"
+	"strings"
+)
+
+// 分词前的文本归一化选项，同时作用于索引和查询
+// 归一化只影响被索引的关键词，持久存储中保存的仍是原文
+type NormalizationOptions struct {
+	// 繁体中文转换为简体中文
+	TraditionalToSimplified bool
+
+	// 全角字母、数字、标点和空格转换为半角
+	FullWidthToHalfWidth bool
+
+	// 拉丁字母转换为小写
+	FoldCase bool
+}
+
+// 按选项对文本做归一化
+func (options *NormalizationOptions) normalize(text string) string {
+	if options.FullWidthToHalfWidth {
+		text = strings.Map(toHalfWidth, text)
+	}
+	if options.FoldCase {
+		text = strings.ToLower(text)
+	}
+	if options.TraditionalToSimplified {
+		text = gojianfan.T2S(text)
+	}
+	return text
+}
+
+// 把全角字符映射到对应的半角字符
+func toHalfWidth(r rune) rune {
+	switch {
+	case r == '　':
+		return ' '
+	case r >= '！' && r <= '～':
+		return r - 0xFEE0
+	}
+	return r
+}
@@ -0,0 +1,26 @@
+package engine
+
+import (
+	"github.com/huichen/wukong/utils"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	all := NormalizationOptions{TraditionalToSimplified: true, FullWidthToHalfWidth: true, FoldCase: true}
+	cases := []struct {
+		options    NormalizationOptions
+		text, want string
+	}{
+		{NormalizationOptions{}, "ＧｏＬａｎｇ 戀愛", "ＧｏＬａｎｇ 戀愛"},
+		{NormalizationOptions{FoldCase: true}, "GoLang 你好", "golang 你好"},
+		// 全角空格和标点也转换为半角，中文句号等不在全角字符区中的标点不变
+		{NormalizationOptions{FullWidthToHalfWidth: true}, "ＡＢＣ１２３！　，。", "ABC123! ,。"},
+		{NormalizationOptions{TraditionalToSimplified: true}, "我們說戀愛", "我们说恋爱"},
+		// 全角字母先转换为半角再转换为小写
+		{all, "ＧｏＬａｎｇ學習", "golang学习"},
+		{all, "", ""},
+	}
+	for _, c := range cases {
+		utils.Expect(t, c.want, c.options.normalize(c.text))
+	}
+}
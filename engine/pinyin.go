@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"github.com/mozillazg/go-pinyin"
+	"octopus/types"
+	"strings"
+	"unicode"
+)
+
+// 拼音索引项的前缀，避免和文档中原有的英文关键词混淆
+const (
+	pinyinKeywordPrefix         = "py:"
+	pinyinInitialsKeywordPrefix = "pyi:"
+)
+
+var (
+	pinyinArgs         = pinyin.NewArgs()
+	pinyinInitialsArgs = pinyin.Args{Style: pinyin.FirstLetter}
+)
+
+// 得到由汉字组成的关键词的全拼和拼音首字母，例如 "男朋友" 得到 "nanpengyou" 和 "npy"
+// 关键词中含有非汉字字符时返回空字符串
+func pinyinForms(word string) (full string, initials string) {
+	for _, r := range word {
+		if !unicode.Is(unicode.Han, r) {
+			return "", ""
+		}
+	}
+	full = strings.Join(pinyin.LazyPinyin(word, pinyinArgs), "")
+	// 单字的首字母区分度太低，不加入索引
+	if len([]rune(word)) > 1 {
+		initials = strings.Join(pinyin.LazyPinyin(word, pinyinInitialsArgs), "")
+	}
+	return
+}
+
+// 为 tokensMap 中的汉字关键词加入拼音索引项，权重和原关键词相同
+func addPinyinKeywords(tokensMap map[string]float32) {
+	for word, weight := range tokensMap {
+		full, initials := pinyinForms(word)
+		if full != "" && weight > tokensMap[pinyinKeywordPrefix+full] {
+			tokensMap[pinyinKeywordPrefix+full] = weight
+		}
+		if initials != "" && weight > tokensMap[pinyinInitialsKeywordPrefix+initials] {
+			tokensMap[pinyinInitialsKeywordPrefix+initials] = weight
+		}
+	}
+}
+
+// 由拉丁字母组成的关键词可能是拼音输入，在其检索词组中加入对应的拼音索引项
+// tokens 为未提取词干的关键词，和 groups 一一对应
+// 全拼的系数为 PinyinWeight，首字母的系数为其一半
+func (engine *Engine) expandPinyin(tokens []string, groups [][]types.QueryToken) {
+	for i, token := range tokens {
+		if !isLatinWord(token) {
+			continue
+		}
+
+		token = strings.ToLower(token)
+		groups[i] = append(groups[i], types.QueryToken{
+			Word: pinyinKeywordPrefix + token, Weight: engine.initOptions.PinyinWeight})
+		if len(token) > 1 {
+			groups[i] = append(groups[i], types.QueryToken{
+				Word: pinyinInitialsKeywordPrefix + token, Weight: engine.initOptions.PinyinWeight / 2})
+		}
+	}
+}
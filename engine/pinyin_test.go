@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/huichen/wukong/utils"
+	"octopus/types"
+	"testing"
+)
+
+func TestPinyinForms(t *testing.T) {
+	cases := []struct {
+		word, full, initials string
+	}{
+		{"男朋友", "nanpengyou", "npy"},
+		// 单字不生成首字母
+		{"男", "nan", ""},
+		// 多音字取最常用的读音
+		{"长城", "changcheng", "cc"},
+		{"音乐", "yinle", "yl"},
+		{"银行", "yinxing", "yx"},
+		{"重庆", "zhongqing", "zq"},
+		// 含有非汉字字符的关键词没有拼音
+		{"男朋友a", "", ""},
+		{"golang", "", ""},
+		{"", "", ""},
+	}
+	for _, c := range cases {
+		full, initials := pinyinForms(c.word)
+		utils.Expect(t, c.full+" "+c.initials, full+" "+initials)
+	}
+}
+
+func TestAddPinyinKeywords(t *testing.T) {
+	// 读音相同的关键词取较大的权重
+	tokensMap := map[string]float32{"男朋友": 0.5, "难朋友": 0.8, "男": 0.3, "golang": 1}
+	addPinyinKeywords(tokensMap)
+	utils.Expect(t, "map[golang:1 py:nan:0.3 py:nanpengyou:0.8 pyi:npy:0.8 男:0.3 男朋友:0.5 难朋友:0.8]", tokensMap)
+}
+
+func TestExpandPinyin(t *testing.T) {
+	var engine Engine
+	engine.initOptions.PinyinWeight = 0.6
+	tokens := []string{"NanPengYou", "男朋友", "n", "go1"}
+	groups := make([][]types.QueryToken, len(tokens))
+	for i, token := range tokens {
+		groups[i] = []types.QueryToken{{Word: token, Weight: 1}}
+	}
+	engine.expandPinyin(tokens, groups)
+	// 只有拉丁字母组成的检索词按拼音扩展，单个字母不按首字母扩展
+	utils.Expect(t, "[[{NanPengYou 1} {py:nanpengyou 0.6} {pyi:nanpengyou 0.3}] [{男朋友 1}] [{n 1} {py:n 0.6}] [{go1 1}]]",
+		fmt.Sprint(groups))
+}
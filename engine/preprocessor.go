@@ -0,0 +1,213 @@
+package engine
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"octopus/types"
+	"regexp"
+	"strings"
+)
+
+// 分词前按 ContentFormat 去掉正文中的标记，持久存储中保存的仍是原文
+func (engine *Engine) preprocessContent(content string) string {
+	switch engine.initOptions.ContentFormat {
+	case HTMLContent:
+		return stripHTML(content, engine.initOptions.SkipCodeBlocks)
+	case MarkdownContent:
+		return stripMarkdown(content, engine.initOptions.SkipCodeBlocks)
+	}
+	return content
+}
+
+// 生成关键词的文本：正文去掉标记后为空时用标题，再做归一化
+func (engine *Engine) keywordText(data types.DocumentIndexData) string {
+	text := engine.preprocessContent(data.Content)
+	if strings.TrimSpace(text) == "" {
+		text = data.Title
+	}
+	return engine.initOptions.Normalization.normalize(text)
+}
+
+// 块级标签的前后换行，避免相邻段落的文字被连在一起分词
+var htmlBlockTags = map[string]bool{
+	"address": true, "article": true, "blockquote": true, "br": true, "dd": true, "div": true,
+	"dl": true, "dt": true, "figcaption": true, "figure": true, "footer": true, "h1": true,
+	"h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "header": true, "hr": true,
+	"li": true, "ol": true, "p": true, "section": true, "table": true, "td": true, "th": true,
+	"tr": true, "ul": true,
+}
+
+// 判断标签内的文字是否不需要索引
+func isSkippedHTMLTag(name string, skipCodeBlocks bool) bool {
+	switch name {
+	case "script", "style", "noscript", "template":
+		return true
+	case "pre", "code":
+		return skipCodeBlocks
+	}
+	return false
+}
+
+// 去掉 HTML 标签、属性和注释，解码 &nbsp; 等实体
+// skipCodeBlocks 为 true 时 <pre> 和 <code> 中的文字也被去掉
+func stripHTML(content string, skipCodeBlocks bool) string {
+	var buf bytes.Buffer
+	tokenizer := html.NewTokenizer(strings.NewReader(content))
+	// 当前位于多少层不需要索引的标签内
+	skipDepth := 0
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			return buf.String()
+		case html.TextToken:
+			if skipDepth == 0 {
+				// &nbsp; 解码后是不间断空格，当作普通空格处理
+				buf.WriteString(strings.Replace(string(tokenizer.Text()), "\u00a0", " ", -1))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if isSkippedHTMLTag(string(name), skipCodeBlocks) {
+				// 自闭合的标签内没有文字，不影响层数
+				if tokenType == html.StartTagToken {
+					skipDepth++
+				} else if tokenType == html.EndTagToken && skipDepth > 0 {
+					skipDepth--
+				}
+			} else if htmlBlockTags[string(name)] {
+				buf.WriteByte('\n')
+			}
+		}
+	}
+}
+
+// Markdown 文字中可以出现的 HTML 标签，其他尖括号如 a<b、vector<int> 当作普通文字
+var markdownHTMLTags = map[string]bool{
+	"a": true, "abbr": true, "aside": true, "audio": true, "b": true, "big": true, "body": true,
+	"button": true, "caption": true, "center": true, "cite": true, "code": true, "col": true,
+	"colgroup": true, "del": true, "details": true, "dfn": true, "em": true, "font": true,
+	"form": true, "head": true, "html": true, "i": true, "iframe": true, "img": true, "input": true,
+	"ins": true, "kbd": true, "label": true, "main": true, "mark": true, "nav": true, "noscript": true,
+	"picture": true, "pre": true, "q": true, "s": true, "samp": true, "script": true, "small": true,
+	"source": true, "span": true, "strike": true, "strong": true, "style": true, "sub": true,
+	"summary": true, "sup": true, "tbody": true, "template": true, "tfoot": true, "thead": true,
+	"u": true, "video": true, "wbr": true,
+}
+
+// 可能是 HTML 标签或注释的片段，标签名在第一个分组中
+var markdownHTMLTag = regexp.MustCompile(`<!--[\s\S]*?-->|</?([A-Za-z][A-Za-z0-9]*)(?:\s[^<>]*)?/?>`)
+
+// 把不属于可识别的 HTML 标签或注释的 < 转义为 &lt;，stripHTML 解码后还原
+func escapeUnknownTags(text string) string {
+	var buf strings.Builder
+	start := 0
+	for _, match := range markdownHTMLTag.FindAllStringSubmatchIndex(text, -1) {
+		buf.WriteString(strings.Replace(text[start:match[0]], "<", "&lt;", -1))
+		tag := text[match[0]:match[1]]
+		if match[2] >= 0 {
+			name := strings.ToLower(text[match[2]:match[3]])
+			if !markdownHTMLTags[name] && !htmlBlockTags[name] {
+				tag = strings.Replace(tag, "<", "&lt;", -1)
+			}
+		}
+		buf.WriteString(tag)
+		start = match[1]
+	}
+	buf.WriteString(strings.Replace(text[start:], "<", "&lt;", -1))
+	return buf.String()
+}
+
+var (
+	markdownFence      = regexp.MustCompile("^\\s{0,3}(```|~~~)")
+	markdownLinePrefix = regexp.MustCompile(`^\s{0,3}(#{1,6}\s+|>\s?|[-*+]\s+|\d+[.)]\s+)+`)
+	markdownImage      = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	markdownLink       = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	markdownInlineCode = regexp.MustCompile("`+([^`]*)`+")
+
+	// 成对的强调和删除线标记，前后不能紧挨字母或数字，标记内的文字首尾不能是空白
+	// 下划线常出现在 __init__ 等标识符中，不当作强调标记，下划线不影响分词
+	markdownEmphasis = []*regexp.Regexp{
+		markdownEmphasisPattern(`\*\*\*`, `*`),
+		markdownEmphasisPattern(`\*\*`, `*`),
+		markdownEmphasisPattern(`\*`, `*`),
+		markdownEmphasisPattern(`~~`, `~`),
+	}
+)
+
+func markdownEmphasisPattern(marker, char string) *regexp.Regexp {
+	return regexp.MustCompile(`(^|[^A-Za-z0-9])` + marker + `([^\s` + char + `](?:[^` + char + `]*[^\s` + char + `])?)` +
+		marker + `($|[^A-Za-z0-9])`)
+}
+
+// 去掉成对的强调标记，标记后的字符被匹配占用，相邻的强调需要多次替换
+func stripMarkdownEmphasis(line string) string {
+	for _, pattern := range markdownEmphasis {
+		for {
+			stripped := pattern.ReplaceAllString(line, "$1$2$3")
+			if stripped == line {
+				break
+			}
+			line = stripped
+		}
+	}
+	return line
+}
+
+// 去掉 Markdown 标记，保留链接和图片的文字
+// 代码以外的文字中可识别的 HTML 标签按 stripHTML 处理，代码原样保留
+// skipCodeBlocks 为 true 时围栏代码块和缩进代码块被去掉，行内代码保留
+func stripMarkdown(content string, skipCodeBlocks bool) string {
+	var buf, text bytes.Buffer
+	// 代码之前的文字先去掉 HTML 标签再写入
+	writeCode := func(code string) {
+		buf.WriteString(stripHTML(escapeUnknownTags(text.String()), skipCodeBlocks))
+		text.Reset()
+		buf.WriteString(code)
+	}
+	inFence := false
+	previousBlank := true
+	inIndentedCode := false
+	for _, line := range strings.Split(content, "\n") {
+		if markdownFence.MatchString(line) {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			if !skipCodeBlocks {
+				writeCode(line + "\n")
+			}
+			continue
+		}
+
+		blank := strings.TrimSpace(line) == ""
+		indented := strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")
+		// 缩进代码块必须跟在空行或另一行缩进代码之后
+		inIndentedCode = indented && !blank && (previousBlank || inIndentedCode)
+		previousBlank = blank
+		if inIndentedCode {
+			if !skipCodeBlocks {
+				writeCode(strings.TrimSpace(line) + "\n")
+			}
+			continue
+		}
+
+		line = markdownLinePrefix.ReplaceAllString(line, "")
+		start := 0
+		for _, match := range markdownInlineCode.FindAllStringSubmatchIndex(line, -1) {
+			text.WriteString(stripMarkdownText(line[start:match[0]]))
+			writeCode(line[match[2]:match[3]])
+			start = match[1]
+		}
+		text.WriteString(stripMarkdownText(line[start:]))
+		text.WriteByte('\n')
+	}
+	writeCode("")
+	return buf.String()
+}
+
+// 去掉行内代码以外的文字中的图片、链接和强调标记
+func stripMarkdownText(text string) string {
+	text = markdownImage.ReplaceAllString(text, "$1")
+	text = markdownLink.ReplaceAllString(text, "$1")
+	return stripMarkdownEmphasis(text)
+}
@@ -0,0 +1,35 @@
+package engine
+
+import (
+	"github.com/huichen/wukong/utils"
+	"testing"
+)
+
+func TestStripMarkdown(t *testing.T) {
+	// 不成对或紧挨字母数字的标记不是强调
+	utils.Expect(t, "use __init__ and a*b*c\n", stripMarkdown("use __init__ and a*b*c", false))
+	utils.Expect(t, "这是重点和斜体，删除 以及 2 * 3 * 4\n", stripMarkdown("这是**重点**和*斜体*，~~删除~~ 以及 2 * 3 * 4", false))
+	utils.Expect(t, "a b c\n", stripMarkdown("*a* *b* ***c***", false))
+
+	content := "# 标题\n\n> 引用 [链接](https://example.com) ![图片](a.png)\n\n```\ncode\n```\n- 列表 `inline`"
+	utils.Expect(t, "标题\n\n引用 链接 图片\n\ncode\n列表 inline\n", stripMarkdown(content, false))
+	utils.Expect(t, "标题\n\n引用 链接 图片\n\n列表 inline\n", stripMarkdown(content, true))
+}
+
+func TestStripHTML(t *testing.T) {
+	content := "<p>你好&nbsp;<b>世界</b></p><script>alert(1)</script><!-- 注释 --><pre>code</pre>"
+	utils.Expect(t, "\n你好 世界\ncode", stripHTML(content, false))
+	utils.Expect(t, "\n你好 世界\n", stripHTML(content, true))
+}
+
+func TestStripMarkdownHTML(t *testing.T) {
+	// 不是 HTML 标签的尖括号保留
+	utils.Expect(t, "如果 a<b 且 if x<y 则 a > b\n", stripMarkdown("如果 a<b 且 if x<y 则 a > b", false))
+	utils.Expect(t, "使用 vector<int> 和 map<string, int>\n", stripMarkdown("使用 vector<int> 和 map<string, int>", false))
+	utils.Expect(t, "粗体 &amp; \n换行\n\n", stripMarkdown("<b>粗体</b> &amp;amp; <br/>换行<!-- 注释 -->\n<script>\nalert(1)\n</script>", false))
+
+	// 代码中的内容原样保留
+	content := "调用 `f(<b>)` 和\n\n```\nif x<y && <div>\n```\n\n    <p>indented</p>"
+	utils.Expect(t, "调用 f(<b>) 和\n\nif x<y && <div>\n\n<p>indented</p>\n", stripMarkdown(content, false))
+	utils.Expect(t, "调用 f(<b>) 和\n\n\n", stripMarkdown(content, true))
+}
@@ -13,26 +13,47 @@ type persistentStorageIndexDocumentRequest struct {
 	data  types.DocumentIndexData
 }
 
+// 持久存储一次事务最多写入的文档数，也是持久存储通道的缓冲长度
+const persistentStorageBatchSize = 1000
+
 func (engine *Engine) persistentStorageIndexDocumentWorker(shard int) {
+	channel := engine.persistentStorageIndexDocumentChannels[shard]
 	for {
-		request := <-engine.persistentStorageIndexDocumentChannels[shard]
+		// 通道中已有的请求合并到一个事务中写入，没有更多请求时立即写入
+		requests := []persistentStorageIndexDocumentRequest{<-channel}
+	collect:
+		for len(requests) < persistentStorageBatchSize {
+			select {
+			case request := <-channel:
+				requests = append(requests, request)
+			default:
+				break collect
+			}
+		}
 
-		// 得到key
-		b := make([]byte, 10)
-		length := binary.PutUvarint(b, request.docId)
+		var keys, values [][]byte
+		for _, request := range requests {
+			// 得到key
+			b := make([]byte, 10)
+			length := binary.PutUvarint(b, request.docId)
 
-		// 得到value
-		var buf bytes.Buffer
-		enc := gob.NewEncoder(&buf)
-		err := enc.Encode(request.data)
-		if err != nil {
-			atomic.AddUint32(&engine.numDocumentsStored, 1)
-			continue
+			// 得到value
+			var buf bytes.Buffer
+			enc := gob.NewEncoder(&buf)
+			if err := enc.Encode(request.data); err != nil {
+				continue
+			}
+			keys = append(keys, b[0:length])
+			values = append(values, buf.Bytes())
 		}
 
-		// 将key-value写入数据库
-		engine.dbs[shard].Set(b[0:length], buf.Bytes())
-		atomic.AddUint32(&engine.numDocumentsStored, 1)
+		// 将key-value写入数据库，字符串 ID 的映射先于文档写入
+		engine.flushDocKeys()
+		engine.dbs[shard].SetBatch(keys, values)
+		if !engine.initOptions.BulkLoad {
+			engine.journalDocuments(shard, keys)
+		}
+		atomic.AddUint32(&engine.numDocumentsStored, uint32(len(requests)))
 	}
 }
 
@@ -41,8 +62,9 @@ func (engine *Engine) persistentStorageRemoveDocumentWorker(docId uint64, shard
 	b := make([]byte, 10)
 	length := binary.PutUvarint(b, docId)
 
-	// 从数据库删除该key
+	// 从数据库删除该key，并记录在日志中，从检查点恢复时同样删除
 	engine.dbs[shard].Delete(b[0:length])
+	engine.journalDocuments(int(shard), [][]byte{b[0:length]})
 }
 
 func (engine *Engine) persistentStorageInitWorker(shard int) {
@@ -58,7 +80,7 @@ func (engine *Engine) persistentStorageInitWorker(shard int) {
 		err := dec.Decode(&data)
 		if err == nil {
 			// 添加索引
-			engine.internalIndexDocument(docId, data, false)
+			engine.internalIndexDocument(docId, data, false, false)
 		}
 		return nil
 	})
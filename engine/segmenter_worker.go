@@ -1,50 +1,78 @@
 package engine
 
 import (
-	"github.com/yanyiwu/gojieba"
 	"octopus/types"
+	"sync/atomic"
 )
 
 type SegmenterRequest struct {
-	DocId       uint32
+	DocId uint64
+
+	// 索引器内部的文档序号，见 doc_ordinals.go
+	Ordinal uint32
+
+	// 同一文档的请求按版本号先后生效，见 doc_shards.go
+	Version uint64
+
 	Hash        uint32
 	Data        types.DocumentIndexData
 	ForceUpdate bool
 }
 
+// 文档按列保存的数值字段，内置字段覆盖同名的自定义字段
+func documentFields(data types.DocumentIndexData) map[string]int64 {
+	fields := make(map[string]int64, len(data.Fields)+3)
+	for name, value := range data.Fields {
+		fields[name] = value
+	}
+	fields[types.PostIdField] = int64(data.PostId)
+	fields[types.CreateTimeField] = int64(data.CreateTime)
+	fields[types.UpdateTimeField] = int64(data.UpdateTime)
+	return fields
+}
+
 func (engine *Engine) SegmenterWorker() {
 	for {
 		request := <-engine.segmenterChannel
-		//if request.DocId == 0 {
-		//	if request.ForceUpdate {
-		//		var i uint32
-		//		for i = 0; i < engine.initOptions.NumShards; i++ {
-		//			engine.indexerAddDocChannels[i] <- IndexerAddDocumentRequest{forceUpdate: true}
-		//		}
-		//	}
-		//	continue
-		//}
-
-		shard := engine.getShard(request.Hash)
-		tokensMap := make(map[string]float32)
-		numTokens := 0
-		// 当文档正文不为空时, 从内容分词中得到关键词
-		if request.Data.Content != "" {
-			segments := gojieba.NewJieba().ExtractWithWeight(request.Data.Content, 1000)
-			Normal := segments[0].Weight
-			for _, segment := range segments {
-				token := segment.Word
-				tokensMap[token] = float32(segment.Weight / Normal)
+		if request.DocId == 0 {
+			if request.ForceUpdate {
+				var i uint32
+				for i = 0; i < engine.initOptions.NumShards; i++ {
+					engine.indexerAddDocChannels[i] <- IndexerAddDocumentRequest{forceUpdate: true}
+				}
 			}
-			numTokens = len(segments)
-		} else {
+			continue
+		}
 
+		shard := engine.getShard(request.Hash)
+		text := engine.keywordText(request.Data)
+		var entities []string
+		rest := text
+		if engine.initOptions.ExtractEntities {
+			entities, rest = extractEntities(text)
+		}
+		tokensMap, numTokens := engine.extractKeywords(rest)
+		engine.addEntityKeywords(tokensMap, entities)
+		numTokens += len(entities)
+		engine.addSpellingWords(tokensMap)
+		fields := documentFields(request.Data)
+		if engine.initOptions.DetectNearDuplicates {
+			// 指纹只用词语和实体计算，不包括二元组和拼音
+			fingerprint := simHash(tokensMap)
+			fields[types.SimHashField] = int64(fingerprint)
+		}
+		if engine.initOptions.UseBigramIndex {
+			addBigramKeywords(tokensMap, text)
+		}
+		if engine.initOptions.UsePinyinIndex {
+			addPinyinKeywords(tokensMap)
 		}
 		indexerRequest := IndexerAddDocumentRequest{
 			document: &types.DocumentIndex{
-				DocId:       request.DocId,
+				DocId:       request.Ordinal,
 				TokenLength: float32(numTokens),
 				Keywords:    make([]types.Keyword, len(tokensMap)),
+				Fields:      fields,
 			},
 			forceUpdate: request.ForceUpdate,
 		}
@@ -56,17 +84,24 @@ func (engine *Engine) SegmenterWorker() {
 			iTokens++
 		}
 
-		engine.indexerAddDocChannels[shard] <- indexerRequest
+		// 内容改变后文档可能换到别的 shard，addToShard 从原来的 shard 中删除
+		if !engine.addToShard(request.Ordinal, request.Version, shard, indexerRequest) {
+			// 已有更新的版本，丢弃这个请求，仍然计入已索引的文档数
+			atomic.AddUint32(&engine.numDocumentsIndexed, 1)
+			if request.ForceUpdate {
+				engine.indexerAddDocChannels[shard] <- IndexerAddDocumentRequest{forceUpdate: true}
+			}
+		}
 
-		//if request.ForceUpdate {
-		//	var i uint32
-		//	for i = 0; i < engine.initOptions.NumShards; i++ {
-		//		if i == shard {
-		//			continue
-		//		}
-		//		engine.indexerAddDocChannels[i] <- IndexerAddDocumentRequest{forceUpdate: true}
-		//	}
-		//}
+		if request.ForceUpdate {
+			var i uint32
+			for i = 0; i < engine.initOptions.NumShards; i++ {
+				if i == shard {
+					continue
+				}
+				engine.indexerAddDocChannels[i] <- IndexerAddDocumentRequest{forceUpdate: true}
+			}
+		}
 		//rankerRequest := rankerAddDocRequest{
 		//	docId: request.DocId, fields: request.Data.Fields}
 		//engine.rankerAddDocChannels[shard] <- rankerRequest
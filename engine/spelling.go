@@ -0,0 +1,202 @@
+package engine
+
+import (
+	"octopus/types"
+	"strings"
+)
+
+// 引擎内部使用的拼音和二元组索引项的前缀，这些索引项不参与纠错和关键词统计
+var internalKeywordPrefixes = []string{pinyinKeywordPrefix, pinyinInitialsKeywordPrefix, bigramKeywordPrefix}
+
+func isInternalKeyword(word string) bool {
+	for _, prefix := range internalKeywordPrefixes {
+		if strings.HasPrefix(word, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// 纠错允许的最大编辑距离，不超过四个字的词只允许一处错误
+func maxEditDistance(word []rune) int {
+	if len(word) <= 4 {
+		return 1
+	}
+	return 2
+}
+
+// 计算两个词之间的编辑距离（插入、删除、替换各计一次），超过 limit 时提前返回 limit+1
+func editDistance(a, b []rune, limit int) int {
+	if d := len(a) - len(b); d > limit || -d > limit {
+		return limit + 1
+	}
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		rowMin := current[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+			if current[j] < rowMin {
+				rowMin = current[j]
+			}
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// 对索引中不存在的关键词给出纠错建议
+func (engine *Engine) spellingSuggestions(tokens []string) (suggestions []types.Suggestion) {
+	suggested := make(map[string]bool)
+	for _, token := range tokens {
+		if suggested[token] || engine.DocumentFrequency(token) > 0 {
+			continue
+		}
+		suggested[token] = true
+		if corrections := engine.corrections(token); len(corrections) > 0 {
+			suggestions = append(suggestions, types.Suggestion{Token: token, Corrections: corrections})
+		}
+	}
+	return
+}
+
+// 从 word 中删除不超过 n 个字得到的全部变体，包括 word 本身
+func deletionVariants(word []rune, n int) []string {
+	variants := []string{string(word)}
+	seen := map[string]bool{string(word): true}
+	frontier := [][]rune{word}
+	for d := 0; d < n; d++ {
+		var next [][]rune
+		for _, w := range frontier {
+			for i := range w {
+				variant := append(append([]rune(nil), w[:i]...), w[i+1:]...)
+				if s := string(variant); !seen[s] {
+					seen[s] = true
+					variants = append(variants, s)
+					next = append(next, variant)
+				}
+			}
+		}
+		frontier = next
+	}
+	return variants
+}
+
+func (engine *Engine) initSpelling() {
+	engine.spelling.words = nil
+	engine.spelling.ids = make(map[string]uint32)
+	engine.spelling.deletions = make(map[string][]uint32)
+	engine.spelling.pinyin = make(map[string][]uint32)
+}
+
+// 把文档的关键词加入纠错词表，已在词表中的词不重复加入
+// 引擎内部的拼音和二元组索引项不参与纠错，应在加入它们之前调用
+func (engine *Engine) addSpellingWords(keywords map[string]float32) {
+	var added []string
+	engine.spelling.RLock()
+	for word := range keywords {
+		if _, found := engine.spelling.ids[word]; !found {
+			added = append(added, word)
+		}
+	}
+	engine.spelling.RUnlock()
+	if len(added) == 0 {
+		return
+	}
+
+	engine.spelling.Lock()
+	defer engine.spelling.Unlock()
+	for _, word := range added {
+		engine.addSpellingWordLocked(word)
+	}
+}
+
+// 词按删除变体和全拼加入索引，词的变体删除不超过 maxEditDistance(词) 个字
+// token 和词的编辑距离不超过 limit 时，token 删去被替换和多出的字、词删去被替换和缺少的字后相同
+// token 一侧删除的字不超过 limit；词一侧在词不超过 4 个字时只需删除一个字，因为 token 更长时至少有一处是多出的字
+func (engine *Engine) addSpellingWordLocked(word string) {
+	if _, found := engine.spelling.ids[word]; found {
+		return
+	}
+	id := uint32(len(engine.spelling.words))
+	engine.spelling.words = append(engine.spelling.words, word)
+	engine.spelling.ids[word] = id
+	runes := []rune(word)
+	for _, variant := range deletionVariants(runes, maxEditDistance(runes)) {
+		engine.spelling.deletions[variant] = append(engine.spelling.deletions[variant], id)
+	}
+	if full, _ := pinyinForms(word); full != "" {
+		engine.spelling.pinyin[full] = append(engine.spelling.pinyin[full], id)
+	}
+}
+
+// 读入检查点后由各 shard 的关键词重建纠错词表
+func (engine *Engine) initSpellingFromIndex() {
+	engine.spelling.Lock()
+	defer engine.spelling.Unlock()
+	for shard := range engine.indexers {
+		engine.indexers[shard].ForEachKeyword(func(word string) {
+			if !isInternalKeyword(word) {
+				engine.addSpellingWordLocked(word)
+			}
+		})
+	}
+}
+
+// 从纠错词表中找出和 token 编辑距离足够小或读音相同的词，按文档频率从高到低返回
+// 由拉丁字母组成的 token 被当作拼音输入，和读音为该拼音的汉字词匹配
+// 词表中的词可能已从索引中删除，只返回仍有文档的词
+func (engine *Engine) corrections(token string) []string {
+	tokenRunes := []rune(token)
+	limit := maxEditDistance(tokenRunes)
+	tokenPinyin, _ := pinyinForms(token)
+	if isLatinWord(token) {
+		tokenPinyin = strings.ToLower(token)
+	}
+
+	// 和 token 编辑距离不超过 limit 的词都和 token 有相同的删除变体，见 addSpellingWordLocked
+	candidates := make(map[string]bool)
+	engine.spelling.RLock()
+	for _, variant := range deletionVariants(tokenRunes, limit) {
+		for _, id := range engine.spelling.deletions[variant] {
+			word := engine.spelling.words[id]
+			if !candidates[word] && editDistance(tokenRunes, []rune(word), limit) <= limit {
+				candidates[word] = true
+			}
+		}
+	}
+	if tokenPinyin != "" {
+		for _, id := range engine.spelling.pinyin[tokenPinyin] {
+			candidates[engine.spelling.words[id]] = true
+		}
+	}
+	engine.spelling.RUnlock()
+
+	frequencies := make(map[string]int)
+	for word := range candidates {
+		if word == token {
+			continue
+		}
+		if frequency := engine.DocumentFrequency(word); frequency > 0 {
+			frequencies[word] = frequency
+		}
+	}
+	return mostFrequent(frequencies, engine.initOptions.MaxSuggestions)
+}
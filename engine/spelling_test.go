@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"github.com/huichen/wukong/utils"
+	"octopus/core"
+	"octopus/types"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		limit    int
+		distance int
+	}{
+		{"恋爱", "恋爱", 1, 0},
+		{"恋爱", "恋人", 1, 1},
+		{"男朋友", "男友", 1, 1},
+		{"golang", "gloang", 2, 2},
+		{"kitten", "sitting", 3, 3},
+		{"", "abc", 3, 3},
+		// 超过 limit 时返回 limit+1
+		{"golang", "go", 2, 3},
+		{"abcdef", "badcfe", 2, 3},
+	}
+	for _, c := range cases {
+		utils.Expect(t, strconv.Itoa(c.distance), editDistance([]rune(c.a), []rune(c.b), c.limit))
+	}
+}
+
+func TestDeletionVariants(t *testing.T) {
+	utils.Expect(t, "[恋爱 爱 恋]", deletionVariants([]rune("恋爱"), 1))
+	utils.Expect(t, "[aab ab aa b a]", deletionVariants([]rune("aab"), 2))
+}
+
+func TestSpellingSuggestions(t *testing.T) {
+	var engine Engine
+	engine.initialized = true
+	engine.initOptions.MaxSuggestions = 2
+	engine.initSpelling()
+	engine.indexers = make([]core.Indexer, 1)
+	engine.indexers[0].Init(core.IndexerInitOptions{})
+	documents := []map[string]float32{
+		{"golang": 1, "男朋友": 1, pinyinKeywordPrefix + "nanpengyou": 1},
+		{"golang": 1, "gulang": 1},
+		{"男朋友": 1, "恋爱": 1},
+		{"python": 1},
+	}
+	for i, keywords := range documents {
+		document := &types.DocumentIndex{DocId: uint32(i + 1)}
+		for word, weight := range keywords {
+			document.Keywords = append(document.Keywords, types.Keyword{Word: word, Weight: weight})
+		}
+		engine.indexers[0].AddDocumentToCache(document, true)
+		delete(keywords, pinyinKeywordPrefix+"nanpengyou")
+		engine.addSpellingWords(keywords)
+	}
+
+	// 长度超过 4 的词允许两处错误，按文档频率排列
+	utils.Expect(t, "[golang gulang]", engine.corrections("gulamg"))
+	utils.Expect(t, "[golang]", engine.corrections("golnag"))
+	utils.Expect(t, "[python]", engine.corrections("pyhton"))
+	// 拉丁字母的 token 按拼音匹配汉字词
+	utils.Expect(t, "[男朋友]", engine.corrections("nanpengyou"))
+	utils.Expect(t, "[男朋友]", engine.corrections("难朋友"))
+	utils.Expect(t, "[]", engine.corrections("婚姻"))
+
+	// 只对索引中不存在的关键词给出建议，已删除文档中的词不再建议
+	engine.indexers[0].RemoveDocument(4)
+	utils.Expect(t, "[{gulamg [golang gulang]}]", engine.spellingSuggestions([]string{"golang", "gulamg", "pyhton"}))
+
+	// 读入检查点后由索引重建词表，内部索引项不加入
+	engine.initSpelling()
+	engine.initSpellingFromIndex()
+	words := append([]string(nil), engine.spelling.words...)
+	sort.Strings(words)
+	utils.Expect(t, "[golang gulang python 恋爱 男朋友]", words)
+}
@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"log"
+	"math"
+	"octopus/core"
+	"octopus/types"
+)
+
+// 每个文档只在一个 shard 中（见 doc_shards.go），各 shard 的统计相加即为全局的精确值
+
+// 全部 shard 中未删除的文档数，此函数线程安全
+func (engine *Engine) NumDocuments() (numDocuments uint32) {
+	if !engine.initialized {
+		log.Fatal("必须先初始化引擎")
+	}
+	for shard := range engine.indexers {
+		numDocuments += engine.indexers[shard].NumDocuments()
+	}
+	return
+}
+
+// 全部 shard 中包含关键词的未删除文档数，此函数线程安全
+func (engine *Engine) DocumentFrequency(word string) (frequency int) {
+	for shard := range engine.indexers {
+		frequency += engine.indexers[shard].DocumentFrequency(word)
+	}
+	return
+}
+
+// 关键词的全局逆文档频率，和 BM25 相同为 log(1 + (N - df + 0.5) / (df + 0.5))
+func (engine *Engine) InverseDocumentFrequency(word string) float32 {
+	return inverseDocumentFrequency(engine.NumDocuments(), engine.DocumentFrequency(word))
+}
+
+func inverseDocumentFrequency(numDocuments uint32, frequency int) float32 {
+	n, df := float64(numDocuments), float64(frequency)
+	return float32(math.Log(1 + (n-df+0.5)/(df+0.5)))
+}
+
+// 把检索词的系数乘以它的全局逆文档频率
+func (engine *Engine) weightByIDF(groups [][]types.QueryToken) {
+	numDocuments := engine.NumDocuments()
+	for _, group := range groups {
+		for i := range group {
+			group[i].Weight *= inverseDocumentFrequency(numDocuments, engine.DocumentFrequency(group[i].Word))
+		}
+	}
+}
+
+// 引擎的统计信息，见 Engine.Stats
+type EngineStats struct {
+	// 全部 shard 中未删除的文档数
+	NumDocuments uint32
+
+	// 各索引器 shard 的统计，关键词数按 shard 分别计算，同一关键词在多个 shard 中重复计数
+	Shards []core.IndexerStats
+
+	// 已分配的文档序号数和字符串 ID 数，文档删除后仍然保留
+	NumOrdinals int
+	NumKeys     int
+
+	// 全部 shard 映射到内存的索引文件字节数
+	MappedBytes int64
+
+	// 全部 shard 和引擎中各映射占用 Go 堆的估计值，不包括分词器的词典
+	MemoryBytes int64
+}
+
+// 得到各 shard 的索引规模和内存占用，需要遍历全部关键词，此函数线程安全
+func (engine *Engine) Stats() (stats EngineStats) {
+	if !engine.initialized {
+		log.Fatal("必须先初始化引擎")
+	}
+	stats.Shards = make([]core.IndexerStats, len(engine.indexers))
+	for shard := range engine.indexers {
+		stats.Shards[shard] = engine.indexers[shard].Stats()
+		stats.NumDocuments += stats.Shards[shard].NumDocuments
+		stats.MappedBytes += stats.Shards[shard].MappedBytes
+		stats.MemoryBytes += stats.Shards[shard].MemoryBytes
+	}
+
+	engine.docOrdinals.RLock()
+	stats.NumOrdinals = len(engine.docOrdinals.docIds)
+	stats.MemoryBytes += core.MapEntryBytes*int64(len(engine.docOrdinals.ordinals)) + 8*int64(stats.NumOrdinals)
+	engine.docOrdinals.RUnlock()
+
+	engine.docKeys.RLock()
+	stats.NumKeys = len(engine.docKeys.docIds)
+	for key := range engine.docKeys.docIds {
+		stats.MemoryBytes += 2*core.MapEntryBytes + int64(len(key))
+	}
+	engine.docKeys.RUnlock()
+
+	engine.docShards.Lock()
+	stats.MemoryBytes += core.MapEntryBytes * int64(len(engine.docShards.shards))
+	engine.docShards.Unlock()
+
+	engine.contentHashes.Lock()
+	stats.MemoryBytes += core.MapEntryBytes * int64(len(engine.contentHashes.hashes))
+	engine.contentHashes.Unlock()
+
+	// 每个指纹在每个分段的索引中各有一项
+	engine.simHashes.RLock()
+	stats.MemoryBytes += int64(len(engine.simHashes.fingerprints)) *
+		(core.MapEntryBytes + int64(len(engine.simHashes.bands))*(core.MapEntryBytes+4))
+	engine.simHashes.RUnlock()
+
+	// 纠错词表中每个删除变体和全拼各有一项，词本身在 words 和 ids 中各保存一次
+	engine.spelling.RLock()
+	for word := range engine.spelling.ids {
+		stats.MemoryBytes += core.MapEntryBytes + 16 + int64(len(word))
+	}
+	for variant, ids := range engine.spelling.deletions {
+		stats.MemoryBytes += core.MapEntryBytes + int64(len(variant)+4*len(ids))
+	}
+	for full, ids := range engine.spelling.pinyin {
+		stats.MemoryBytes += core.MapEntryBytes + int64(len(full)+4*len(ids))
+	}
+	engine.spelling.RUnlock()
+	return
+}
+
+// 关键词在全部 shard 中的倒排表统计，各项为各 shard 之和，此函数线程安全
+func (engine *Engine) KeywordStats(word string) core.KeywordStats {
+	if !engine.initialized {
+		log.Fatal("必须先初始化引擎")
+	}
+	total := core.KeywordStats{Word: word}
+	for shard := range engine.indexers {
+		stats := engine.indexers[shard].KeywordStats(word)
+		total.DocumentFrequency += stats.DocumentFrequency
+		total.PostingLength += stats.PostingLength
+		total.NumSegments += stats.NumSegments
+		total.NumBlocks += stats.NumBlocks
+		total.Bytes += stats.Bytes
+	}
+	return total
+}
+
+// 按全部 shard 中未删除的文档数从大到小返回前 k 个关键词，文档数相同时按字典序排列，此函数线程安全
+// 先取各 shard 的前 n 个关键词作为候选，不在某个 shard 前 n 名中的关键词在该 shard 中的文档数不超过它的第 n 名
+// 候选中第 k 名的全局文档数超过各 shard 第 n 名之和时结果是精确的，否则加倍 n 重新计算
+func (engine *Engine) TopKeywords(k int) []core.KeywordFrequency {
+	if !engine.initialized {
+		log.Fatal("必须先初始化引擎")
+	}
+	if k <= 0 {
+		return nil
+	}
+	for n := k; ; n *= 2 {
+		candidates := make(map[string]bool)
+		// 不在候选中的关键词的全局文档数上限，各 shard 的关键词都是候选时为 0
+		bound := 0
+		for shard := range engine.indexers {
+			keywords := engine.indexers[shard].TopKeywords(n)
+			for _, keyword := range keywords {
+				candidates[keyword.Word] = true
+			}
+			if len(keywords) == n {
+				bound += keywords[n-1].Frequency
+			}
+		}
+		top := make([]core.KeywordFrequency, 0, len(candidates))
+		for word := range candidates {
+			top = append(top, core.KeywordFrequency{Word: word, Frequency: engine.DocumentFrequency(word)})
+		}
+		core.SortKeywordsByFrequency(top)
+		if len(top) > k {
+			top = top[:k]
+		}
+		if bound == 0 || (len(top) == k && top[k-1].Frequency > bound) {
+			return top
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"github.com/huichen/wukong/utils"
+	"octopus/core"
+	"octopus/types"
+	"testing"
+)
+
+func TestTopKeywords(t *testing.T) {
+	var engine Engine
+	engine.initialized = true
+	engine.indexers = make([]core.Indexer, 2)
+	docId := uint32(0)
+	addDocuments := func(shard int, word string, count int) {
+		for i := 0; i < count; i++ {
+			docId++
+			engine.indexers[shard].AddDocumentToCache(&types.DocumentIndex{
+				DocId: docId, Keywords: []types.Keyword{{Word: word, Weight: 1}}}, true)
+		}
+	}
+	for shard := range engine.indexers {
+		engine.indexers[shard].Init(core.IndexerInitOptions{InternalKeywordPrefixes: internalKeywordPrefixes})
+	}
+	addDocuments(0, "恋爱", 3)
+	addDocuments(0, "婚姻", 2)
+	addDocuments(1, "分手", 3)
+	addDocuments(1, "婚姻", 2)
+	// 拼音和二元组索引项不计入
+	addDocuments(0, pinyinKeywordPrefix+"hunyin", 3)
+	addDocuments(1, bigramKeywordPrefix+"婚姻", 3)
+
+	// 婚姻不是任何 shard 的第 1 名，但全局文档数最多
+	utils.Expect(t, "[{婚姻 4}]", engine.TopKeywords(1))
+	utils.Expect(t, "[{婚姻 4} {分手 3} {恋爱 3}]", engine.TopKeywords(3))
+	utils.Expect(t, "[{婚姻 4} {分手 3} {恋爱 3}]", engine.TopKeywords(10))
+	utils.Expect(t, "0", len(engine.TopKeywords(0)))
+	stats := engine.indexers[0].Stats()
+	utils.Expect(t, "[2 1]", []int{stats.NumKeywords, stats.NumInternalKeywords})
+}
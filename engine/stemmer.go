@@ -0,0 +1,42 @@
+package engine
+
+import (
+	"github.com/kljensen/snowball/english"
+	"strings"
+	"unicode"
+)
+
+// 判断词语是否全部由拉丁字母组成
+func isLatinWord(word string) bool {
+	if word == "" {
+		return false
+	}
+	for _, r := range word {
+		if r > unicode.MaxASCII || !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// 把由拉丁字母组成的词语转换为小写并提取词干，例如 "Goroutines" 得到 "goroutin"
+// 其它词语原样返回
+func stemWord(word string) string {
+	if !isLatinWord(word) {
+		return word
+	}
+	return english.Stem(strings.ToLower(word), false)
+}
+
+// 按选项对拉丁字母组成的关键词提取词干
+func (engine *Engine) stemKeyword(word string) string {
+	if engine.initOptions.StemEnglishWords {
+		return stemWord(word)
+	}
+	return word
+}
+
+// 对词典中的单个词语做和关键词相同的归一化和词干提取
+func (engine *Engine) analyzeWord(word string) string {
+	return engine.stemKeyword(engine.initOptions.Normalization.normalize(word))
+}
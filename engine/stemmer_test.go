@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"github.com/huichen/wukong/utils"
+	"testing"
+)
+
+func TestStemWord(t *testing.T) {
+	cases := []struct {
+		word, stem string
+	}{
+		// 复数
+		{"cats", "cat"},
+		{"indexes", "index"},
+		{"queries", "queri"},
+		{"Goroutines", "goroutin"},
+		// 动词的各种形式
+		{"running", "run"},
+		{"runs", "run"},
+		{"indexed", "index"},
+		{"indexing", "index"},
+		{"studying", "studi"},
+		{"connection", "connect"},
+		{"connecting", "connect"},
+		// 不规则变化不处理
+		{"ran", "ran"},
+		// 不全是拉丁字母的词语原样返回
+		{"go1", "go1"},
+		{"C++", "C++"},
+		{"恋爱", "恋爱"},
+		{"", ""},
+	}
+	for _, c := range cases {
+		utils.Expect(t, c.stem, stemWord(c.word))
+	}
+}
+
+func TestAnalyzeWord(t *testing.T) {
+	var engine Engine
+	utils.Expect(t, "Running", engine.analyzeWord("Running"))
+	engine.initOptions.StemEnglishWords = true
+	utils.Expect(t, "run", engine.analyzeWord("Running"))
+	// 全角字母先归一化再提取词干
+	engine.initOptions.Normalization = NormalizationOptions{FullWidthToHalfWidth: true, FoldCase: true}
+	utils.Expect(t, "queri", engine.analyzeWord("ＱＵＥＲＩＥＳ"))
+}
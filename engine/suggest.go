@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"log"
+	"sort"
+)
+
+// 返回以 prefix 开头、文档数最多的 n 个关键词，用于搜索框的自动补全，此函数线程安全
+// 文档数为全部 shard 之和，prefix 会按和索引相同的方式归一化
+func (engine *Engine) Suggest(prefix string, n int) []string {
+	if !engine.initialized {
+		log.Fatal("必须先初始化引擎")
+	}
+	prefix = engine.initOptions.Normalization.normalize(prefix)
+	if prefix == "" || n <= 0 {
+		return nil
+	}
+
+	frequencies := make(map[string]int)
+	for shard := range engine.indexers {
+		for _, keyword := range engine.indexers[shard].PrefixKeywords(prefix) {
+			if !isInternalKeyword(keyword.Word) {
+				frequencies[keyword.Word] += keyword.Frequency
+			}
+		}
+	}
+	return mostFrequent(frequencies, n)
+}
+
+// 返回 frequencies 中文档数最多的 n 个词，文档数相同时按字典序排列
+func mostFrequent(frequencies map[string]int, n int) []string {
+	words := make([]string, 0, len(frequencies))
+	for word := range frequencies {
+		words = append(words, word)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if frequencies[words[i]] != frequencies[words[j]] {
+			return frequencies[words[i]] > frequencies[words[j]]
+		}
+		return words[i] < words[j]
+	})
+	if len(words) > n {
+		words = words[:n]
+	}
+	return words
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"octopus/types"
+	"os"
+	"strings"
+)
+
+// 读取同义词文件，返回从词语到其全部同义词的映射
+// 每行一组同义词，用半角或全角逗号分隔，例如 "男朋友, 男友, bf"
+// 空行和以 # 开头的行被忽略，一个词出现在多组中时合并这些组
+// 每个同义词经 analyze 处理，以便和归一化及提取词干后的关键词匹配
+func loadSynonyms(paths []string, analyze func(string) string) (map[string][]string, error) {
+	synonyms := make(map[string][]string)
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("无法读取同义词文件 %s: %v", path, err)
+		}
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			var group []string
+			for _, word := range strings.FieldsFunc(line, func(r rune) bool {
+				return r == ',' || r == '，'
+			}) {
+				if word = analyze(strings.TrimSpace(word)); word != "" {
+					group = append(group, word)
+				}
+			}
+			for _, word := range group {
+				for _, synonym := range group {
+					if synonym != word && !containsWord(synonyms[word], synonym) {
+						synonyms[word] = append(synonyms[word], synonym)
+					}
+				}
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("无法读取同义词文件 %s: %v", path, err)
+		}
+	}
+	return synonyms, nil
+}
+
+// 把每个关键词扩展为一个 OR 检索词组，同义词的系数为 SynonymWeight
+// 第二个返回值记录了实际发生的扩展
+func (engine *Engine) expandSynonyms(tokens []string) ([][]types.QueryToken, []types.TokenExpansion) {
+	engine.segmenterLock.RLock()
+	synonyms := engine.segmenterLock.synonyms
+	engine.segmenterLock.RUnlock()
+
+	groups := make([][]types.QueryToken, len(tokens))
+	var expansions []types.TokenExpansion
+	for i, token := range tokens {
+		groups[i] = []types.QueryToken{{Word: token, Weight: 1}}
+		words := synonyms[token]
+		if len(words) == 0 {
+			continue
+		}
+		for _, word := range words {
+			groups[i] = append(groups[i], types.QueryToken{
+				Word: word, Weight: engine.initOptions.SynonymWeight})
+		}
+		expansions = append(expansions, types.TokenExpansion{Token: token, Expansions: words})
+	}
+	return groups, expansions
+}
+
+func containsWord(words []string, word string) bool {
+	for _, w := range words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
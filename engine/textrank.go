@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"github.com/yanyiwu/gojieba"
+	"sort"
+	"unicode/utf8"
+)
+
+const (
+	// 共现窗口大小，窗口内的词之间连一条边
+	textRankWindow = 5
+
+	// 阻尼系数和迭代次数
+	textRankDamping    = 0.85
+	textRankIterations = 10
+)
+
+// 用 TextRank 算法从分词结果中提取得分最高的 topK 个关键词，按得分从大到小排列
+// 单字词区分度太低，不作为候选关键词
+func textRank(words []string, topK int) []gojieba.WordWeight {
+	var candidates []string
+	for _, word := range words {
+		if utf8.RuneCountInString(word) > 1 {
+			candidates = append(candidates, word)
+		}
+	}
+
+	// 建立无向共现图，边的权重为共现次数
+	graph := make(map[string]map[string]float64)
+	for i, word := range candidates {
+		if graph[word] == nil {
+			graph[word] = make(map[string]float64)
+		}
+		for j := i + 1; j < i+textRankWindow && j < len(candidates); j++ {
+			other := candidates[j]
+			if other == word {
+				continue
+			}
+			if graph[other] == nil {
+				graph[other] = make(map[string]float64)
+			}
+			graph[word][other]++
+			graph[other][word]++
+		}
+	}
+
+	outWeights := make(map[string]float64, len(graph))
+	scores := make(map[string]float64, len(graph))
+	for word, edges := range graph {
+		for _, weight := range edges {
+			outWeights[word] += weight
+		}
+		scores[word] = 1
+	}
+	for iteration := 0; iteration < textRankIterations; iteration++ {
+		next := make(map[string]float64, len(graph))
+		for word, edges := range graph {
+			score := 0.0
+			for other, weight := range edges {
+				score += weight / outWeights[other] * scores[other]
+			}
+			next[word] = 1 - textRankDamping + textRankDamping*score
+		}
+		scores = next
+	}
+
+	keywords := make([]gojieba.WordWeight, 0, len(scores))
+	for word, score := range scores {
+		keywords = append(keywords, gojieba.WordWeight{Word: word, Weight: score})
+	}
+	sort.Slice(keywords, func(i, j int) bool {
+		if keywords[i].Weight != keywords[j].Weight {
+			return keywords[i].Weight > keywords[j].Weight
+		}
+		return keywords[i].Word < keywords[j].Word
+	})
+	if len(keywords) > topK {
+		keywords = keywords[:topK]
+	}
+	return keywords
+}
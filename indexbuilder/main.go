@@ -0,0 +1,244 @@
+// 离线建立索引：读入文档导出文件，并行分词后写出索引检查点和持久存储文件
+// 输出目录直接作为服务的 PersistentStorageFolder，启动时读入检查点，不必再逐个调用 IndexDocument
+// 持久存储按批写入，不记录日志，见 EngineInitOptions.BulkLoad
+//
+// 用法：
+//
+//	indexbuilder -input docs.jsonl -output data -shards 4 -storage_shards 2
+//	mysql -B -e "select id,pid,title,content,created,updated from zhihudata" | indexbuilder -format tsv -output data
+//
+// 影响索引的选项必须和服务的 EngineInitOptions 一致，否则文档所在的 shard 和关键词都会对不上
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"octopus/engine"
+	"octopus/types"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	input         = flag.String("input", "-", "文档导出文件，- 表示标准输入")
+	format        = flag.String("format", "jsonl", "导出文件格式：jsonl 或 tsv（MySQL 导出）")
+	output        = flag.String("output", "", "输出目录，必须为空或不存在")
+	numShards     = flag.Int("shards", 1, "索引器 shard 数，同 EngineInitOptions.NumShards")
+	storageShards = flag.Int("storage_shards", 1, "持久存储 shard 数，同 EngineInitOptions.PersistentStorageShards")
+	dictionaries  = flag.String("dictionaries", "", "用户词典文件，逗号分隔")
+	synonyms      = flag.String("synonyms", "", "同义词文件，逗号分隔")
+	contentFormat = flag.String("content_format", "plain", "正文格式：plain、html 或 markdown")
+	extraction    = flag.String("keyword_extraction", "tfidf", "关键词提取方式：tfidf、tf 或 textrank")
+	entities      = flag.Bool("extract_entities", false, "是否提取网址、话题等实体")
+	stem          = flag.Bool("stem", false, "是否对英文单词做词干提取")
+	pinyin        = flag.Bool("pinyin", false, "是否建立拼音索引")
+	bigram        = flag.Bool("bigram", false, "是否建立二元组索引")
+)
+
+var (
+	contentFormats = map[string]int{
+		"plain":    engine.PlainTextContent,
+		"html":     engine.HTMLContent,
+		"markdown": engine.MarkdownContent,
+	}
+	keywordExtractions = map[string]int{
+		"tfidf":    engine.TFIDFExtraction,
+		"tf":       engine.TermFrequencyExtraction,
+		"textrank": engine.TextRankExtraction,
+	}
+)
+
+// 导出文件中的一个文档，DocId 为 0 时用字符串 ID Key 标识
+type document struct {
+	DocId uint64
+	Key   string
+	types.DocumentIndexData
+}
+
+func main() {
+	flag.Parse()
+	if *output == "" {
+		log.Fatal("必须指定输出目录")
+	}
+	if paths, _ := filepath.Glob(filepath.Join(*output, "*")); len(paths) > 0 {
+		log.Fatal("输出目录不为空: ", *output)
+	}
+	parse, found := map[string]func(line string) (document, error){
+		"jsonl": parseJSONLine,
+		"tsv":   parseMysqlLine,
+	}[*format]
+	if !found {
+		log.Fatal("不支持的格式: ", *format)
+	}
+	options := engine.EngineInitOptions{
+		NumShards:               uint32(*numShards),
+		ExtractEntities:         *entities,
+		StemEnglishWords:        *stem,
+		UsePinyinIndex:          *pinyin,
+		UseBigramIndex:          *bigram,
+		UsePersistentStorage:    true,
+		PersistentStorageFolder: *output,
+		PersistentStorageShards: *storageShards,
+		BulkLoad:                true,
+	}
+	if options.ContentFormat, found = contentFormats[*contentFormat]; !found {
+		log.Fatal("不支持的正文格式: ", *contentFormat)
+	}
+	if options.KeywordExtraction, found = keywordExtractions[*extraction]; !found {
+		log.Fatal("不支持的关键词提取方式: ", *extraction)
+	}
+	if *dictionaries != "" {
+		options.UserDictionaryFiles = strings.Split(*dictionaries, ",")
+	}
+	if *synonyms != "" {
+		options.SynonymFiles = strings.Split(*synonyms, ",")
+	}
+
+	reader := os.Stdin
+	if *input != "-" {
+		file, err := os.Open(*input)
+		if err != nil {
+			log.Fatal("无法打开导出文件", *input, ": ", err)
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	var searcher engine.Engine
+	searcher.Init(options)
+
+	// 多个协程同时提交文档，分词在引擎的分词器协程中并行进行
+	// 同一 DocId 出现多次时保留哪一个不确定，导出文件中的 DocId 应唯一
+	lines := make(chan string, runtime.NumCPU())
+	var numDocuments, numSkipped uint64
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for line := range lines {
+				doc, err := parse(line)
+				if err == nil && doc.DocId > engine.MaxDocId {
+					err = errors.New("DocId 超过 MaxDocId: " + strconv.FormatUint(doc.DocId, 10))
+				}
+				if err != nil {
+					fmt.Println("跳过无法解析的行:", err)
+					atomic.AddUint64(&numSkipped, 1)
+					continue
+				}
+				if doc.DocId == 0 {
+					searcher.IndexDocumentByKey(doc.Key, doc.DocumentIndexData, false)
+				} else {
+					searcher.IndexDocument(doc.DocId, doc.DocumentIndexData, false)
+				}
+				if n := atomic.AddUint64(&numDocuments, 1); n%10000 == 0 {
+					fmt.Println("已提交文档数:", n)
+				}
+			}
+		}()
+	}
+	err := readLines(reader, lines)
+	close(lines)
+	wg.Wait()
+	if err != nil {
+		log.Fatal("读取导出文件失败: ", err)
+	}
+
+	// 关闭时等待索引和持久存储写入完毕，保存检查点后关闭数据库
+	searcher.Close()
+	fmt.Println("索引完成，文档数:", numDocuments, "跳过行数:", numSkipped)
+}
+
+// 把 r 中的非空行依次送入 lines，行可以任意长
+func readLines(r io.Reader, lines chan<- string) error {
+	reader := bufio.NewReaderSize(r, 1<<20)
+	for {
+		line, err := reader.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			lines <- line
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// 每行一个 JSON 对象，字段为 DocId 或 Key 和 DocumentIndexData 的各字段
+func parseJSONLine(line string) (doc document, err error) {
+	err = json.Unmarshal([]byte(line), &doc)
+	return
+}
+
+// mysql -B 或 SELECT ... INTO OUTFILE 导出的制表符分隔的行
+// 各列依次为 id、pid、title、content、created、updated，和 IndexBulkDocumentFromMysql 读取的列相同
+// mysql -B 输出的第一行是列名，id 不是数字，被当作无法解析的行跳过
+func parseMysqlLine(line string) (doc document, err error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 6 {
+		return doc, errors.New("列数不是 6: " + strconv.Itoa(len(fields)))
+	}
+	for i := range fields {
+		fields[i] = unescapeMysql(fields[i])
+	}
+	if doc.DocId, err = strconv.ParseUint(fields[0], 10, 64); err != nil {
+		return
+	}
+	doc.Title = fields[2]
+	doc.Content = fields[3]
+	numbers := []*uint32{&doc.PostId, &doc.CreateTime, &doc.UpdateTime}
+	for i, field := range []string{fields[1], fields[4], fields[5]} {
+		if field == "" {
+			continue
+		}
+		n, e := strconv.ParseUint(field, 10, 32)
+		if e != nil {
+			return doc, e
+		}
+		*numbers[i] = uint32(n)
+	}
+	return
+}
+
+// 还原 MySQL 导出时转义的字符，\N 表示 NULL，还原为空字符串
+func unescapeMysql(field string) string {
+	if field == `\N` {
+		return ""
+	}
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+	var builder strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] != '\\' || i == len(field)-1 {
+			builder.WriteByte(field[i])
+			continue
+		}
+		i++
+		switch field[i] {
+		case 'n':
+			builder.WriteByte('\n')
+		case 't':
+			builder.WriteByte('\t')
+		case 'r':
+			builder.WriteByte('\r')
+		case '0':
+			builder.WriteByte(0)
+		default:
+			builder.WriteByte(field[i])
+		}
+	}
+	return builder.String()
+}
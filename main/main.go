@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"octopus/engine"
 	"octopus/types"
+	"strings"
 )
 
 var (
@@ -35,12 +36,33 @@ func main() {
 	for ; ; {
 		fmt.Printf("请输入关键词: ")
 		fmt.Scanln(&text) //Scanln 扫描来自标准输入的文本，将空格分隔的值依次存放到后续的参数内，直到碰到换行
+		if text == ":reload" {
+			// 重新加载用户词典，并重建受新词影响的文档索引
+			reloadDictionary()
+			continue
+		}
+		if text == ":stats" {
+			// 查看各 shard 的索引规模、内存占用和文档数最多的关键词
+			printStats()
+			continue
+		}
+		if strings.HasPrefix(text, ":stats=") {
+			// 查看一个关键词的倒排表，如 :stats=恋爱
+			printKeywordStats(strings.TrimPrefix(text, ":stats="))
+			continue
+		}
 		fmt.Println("查询结果为：")
-		pairlist := searcher.Search(types.SearchRequest{Text: text})
-		for _, v := range pairlist {
+		response := searcher.Search(types.SearchRequest{Text: text})
+		for _, expansion := range response.Expansions {
+			fmt.Println("同义词扩展:", expansion.Token, "->", expansion.Expansions)
+		}
+		for _, suggestion := range response.Suggestions {
+			fmt.Println("您是不是要找:", suggestion.Token, "->", suggestion.Corrections)
+		}
+		for _, v := range response.Docs {
 			fmt.Println("----------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------")
-			fmt.Println("帖子id", v.Key)
-			fmt.Println("评分:", v.Value)
+			fmt.Println("帖子id", v.DocId)
+			fmt.Println("评分:", v.Scores[0])
 			//ReadMysql("127.0.0.1", "3306", v.Key)
 			fmt.Println("----------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------")
 			fmt.Println()
@@ -48,6 +70,50 @@ func main() {
 	}
 }
 
+// 重新加载用户词典，并重新索引持久存储中包含新增或删除词条的文档
+func reloadDictionary() {
+	added, removed, err := searcher.ReloadDictionary()
+	if err != nil {
+		fmt.Println("重新加载词典失败:", err)
+		return
+	}
+	fmt.Println("新增词条:", added, "删除词条:", removed)
+	words := append(added, removed...)
+	if len(words) == 0 {
+		return
+	}
+	numDocs, err := searcher.ReindexStoredDocuments(words)
+	if err != nil {
+		fmt.Println("重建索引失败:", err)
+		return
+	}
+	fmt.Println("重新索引文档数:", numDocs)
+}
+
+// 打印索引统计信息
+func printStats() {
+	stats := searcher.Stats()
+	fmt.Println("文档数:", stats.NumDocuments, "文档序号数:", stats.NumOrdinals, "字符串 ID 数:", stats.NumKeys)
+	for shard, s := range stats.Shards {
+		fmt.Printf("shard %d: 文档数 %d 待索引 %d 已删除 %d 段数 %d(映射 %d) 关键词数 %d 倒排表长度 %d 倒排表字节数 %d 内存 %d\n",
+			shard, s.NumDocuments, s.NumCachedDocuments, s.NumDeletedDocuments, s.NumSegments, s.NumMappedSegments,
+			s.NumKeywords, s.NumPostings, s.PostingBytes, s.MemoryBytes)
+	}
+	fmt.Println("内存估计:", stats.MemoryBytes, "映射文件:", stats.MappedBytes)
+	fmt.Println("文档数最多的关键词:")
+	for _, keyword := range searcher.TopKeywords(20) {
+		fmt.Println(keyword.Word, keyword.Frequency)
+	}
+}
+
+// 打印一个关键词的倒排表统计
+func printKeywordStats(word string) {
+	stats := searcher.KeywordStats(word)
+	fmt.Println("关键词:", stats.Word)
+	fmt.Println("文档数:", stats.DocumentFrequency, "倒排表长度:", stats.PostingLength)
+	fmt.Println("段数:", stats.NumSegments, "块数:", stats.NumBlocks, "字节数:", stats.Bytes)
+}
+
 //从mysql获取文档加入索引
 func ReadMysql(mysql_ip string, mysql_port string, id uint32) {
 	//打开数据库
@@ -37,6 +37,18 @@ func (s *boltStorage) Set(k []byte, v []byte) error {
 	})
 }
 
+func (s *boltStorage) SetBatch(keys [][]byte, values [][]byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(wukong_documents)
+		for i, k := range keys {
+			if err := bucket.Put(k, values[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (s *boltStorage) Get(k []byte) (b []byte, err error) {
 	err = s.db.View(func(tx *bolt.Tx) error {
 		b = tx.Bucket(wukong_documents).Get(k)
@@ -21,6 +21,13 @@ func TestOpenOrCreateBolt(t *testing.T) {
 	utils.Expect(t, "<nil>", err)
 	utils.Expect(t, "value1", string(buffer))
 
+	err = db.SetBatch([][]byte{[]byte("key1"), []byte("key2")}, [][]byte{[]byte("value2"), []byte("value3")})
+	utils.Expect(t, "<nil>", err)
+	buffer, _ = db.Get([]byte("key1"))
+	utils.Expect(t, "value2", string(buffer))
+	buffer, _ = db.Get([]byte("key2"))
+	utils.Expect(t, "value3", string(buffer))
+
 	walFile := db.WALName()
 	db.Close()
 	os.Remove(walFile)
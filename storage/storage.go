@@ -17,6 +17,8 @@ func RegisterStorageEngine(name string, fn func(path string) (Storage, error)) {
 
 type Storage interface {
 	Set(k, v []byte) error
+	// 在一个事务中写入多个键值，keys 和 values 一一对应
+	SetBatch(keys, values [][]byte) error
 	Get(k []byte) ([]byte, error)
 	Delete(k []byte) error
 	ForEach(fn func(k, v []byte) error) error
@@ -11,10 +11,22 @@ type DocumentIndexData struct {
 	CreateTime uint32
 	//更新时间
 	UpdateTime uint32
+	//自定义数值字段，和 PostId、CreateTime、UpdateTime 一起按列保存，用于过滤和排序
+	Fields map[string]int64
 }
 
+// 按列保存的内置数值字段名，自定义字段不能和它们重名
+const (
+	PostIdField     = "PostId"
+	CreateTimeField = "CreateTime"
+	UpdateTimeField = "UpdateTime"
+
+	// 开启 EngineInitOptions.DetectNearDuplicates 时保存文档的 SimHash 指纹
+	SimHashField = "SimHash"
+)
+
 type DocumentIndex struct {
-	// 文本的DocId
+	// 文本在索引器内部的序号，由引擎从 64 位的 DocId 映射得到
 	DocId uint32
 
 	// 文本的关键词长
@@ -22,6 +34,9 @@ type DocumentIndex struct {
 
 	// 加入的索引键
 	Keywords []Keyword
+
+	// 文档的数值字段，包括内置字段和自定义字段
+	Fields map[string]int64
 }
 
 // 文档的一个关键词
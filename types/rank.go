@@ -9,4 +9,11 @@ type RankOptions struct {
 
 	// 最大输出的搜索结果数，为0时无限制
 	MaxOutputs int32
+
+	// 不为空时按该数值字段从大到小排序（ReverseOrder=true 时从小到大），字段值相同时按分数从大到小排序
+	// 字段见 DocumentIndexData.Fields 和 PostIdField 等内置字段
+	SortByField string
+
+	// 近似重复的文档是否只保留排在最前的一个，需开启 EngineInitOptions.DetectNearDuplicates
+	CollapseNearDuplicates bool
 }
@@ -4,12 +4,31 @@ type SearchRequest struct {
 	// 搜索的短语（必须是UTF-8格式），会被分词
 	// 当值为空字符串时关键词会从下面的Tokens读入
 	Text string
+
+	// 标签，作为完整的关键词匹配，不会被分词
+	// 可以用来查找网址、@提及、#话题# 等被单独索引的实体
+	// 标签只过滤文档，不参与打分；只有标签时返回带有全部标签的文档，得分为 0
+	Labels []string
+
+	// 不为空时只在这些文档中搜索
+	DocIds []uint64
+
+	// 数值字段的范围，只返回各字段值都在范围之中的文档
+	// 每个范围在每个 shard 中扫描一次整列，文档很多时开销和文档数成正比
+	FieldRanges []FieldRange
+
+	// 排序和输出选项，为 nil 时使用默认值
+	// MaxOutputs 大于 0 且按分数从大到小排序时只计算得分最高的 OutputOffset+MaxOutputs 个文档
+	RankOptions *RankOptions
 }
 
 type SearchResponse struct {
 	// 搜索用到的关键词
 	Tokens []string
 
+	// 查询时对关键词做的同义词扩展
+	Expansions []TokenExpansion
+
 	// 搜索到的文档，已排序
 	Docs []ScoredDocument
 
@@ -17,12 +36,19 @@ type SearchResponse struct {
 	Timeout bool
 
 	// 搜索到的文档个数。注意这是全部文档中满足条件的个数，可能比返回的文档数要大
+	// 使用 RankOptions.MaxOutputs 时不计算排名靠后文档的得分，但仍统计它们的个数
 	NumDocs int
+
+	// 没有搜索到文档时对索引中不存在的关键词给出的纠错建议
+	Suggestions []Suggestion
 }
 
 type ScoredDocument struct {
 	DocId uint64
 
+	// 用 Engine.IndexDocumentByKey 加入的文档的字符串 ID，其他文档为空
+	Key string
+
 	// 文档的打分值
 	// 搜索结果按照Scores的值排序，先按照第一个数排，如果相同则按照第二个数排序，依次类推。
 	Scores []float32
@@ -34,4 +60,46 @@ type ScoredDocument struct {
 	// 关键词出现的位置
 	// 只有当IndexType == LocationsIndex时不为空
 	TokenLocations [][]int
-}
\ No newline at end of file
+}
+
+// 和某个文档近似重复的文档
+type NearDuplicate struct {
+	DocId uint64
+
+	// 用字符串 ID 加入的文档的字符串 ID
+	Key string
+
+	// 两个文档 SimHash 指纹的汉明距离
+	Distance int
+}
+
+// 数值字段的范围 [Min, Max]
+type FieldRange struct {
+	Field string
+	Min   int64
+	Max   int64
+}
+
+// 检索词，Weight 为该词命中时得分的系数
+type QueryToken struct {
+	Word   string
+	Weight float32
+}
+
+// 一个关键词被扩展出的检索词
+type TokenExpansion struct {
+	// 原始关键词
+	Token string
+
+	// 扩展出的检索词，和原始关键词之间是 OR 关系
+	Expansions []string
+}
+
+// 对一个关键词的纠错建议
+type Suggestion struct {
+	// 索引中不存在的关键词
+	Token string
+
+	// 索引中和该关键词字形或读音相近的词，按文档频率从高到低排序
+	Corrections []string
+}